@@ -18,35 +18,71 @@
 package anvil
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"strings"
 	"time"
 
-	"golang.org/x/crypto/ed25519"
-
 	"zntr.io/anvil/forge"
 	"zntr.io/anvil/internal"
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/meld"
+	"zntr.io/anvil/seal"
+	"zntr.io/anvil/session"
+	"zntr.io/anvil/suite"
 	"zntr.io/anvil/tap"
 )
 
 // Meld a challenge from given credentials
-func Meld(principal, password, challenge string) (string, error) {
-	// Derive password to get keys
-	pub, priv, err := derivePassword([]byte(principal), []byte(password))
+func Meld(principal, password, challenge string, opts ...meld.Option) (string, error) {
+	return MeldContext(context.Background(), principal, password, challenge, opts...)
+}
+
+// MeldContext melds a challenge from given credentials, password derivation is
+// aborted when the context is done.
+func MeldContext(ctx context.Context, principal, password, challenge string, opts ...meld.Option) (string, error) {
+	// Default settings
+	dopts := meld.Options{
+		KDF:    kdf.DefaultParams,
+		MaxKDF: kdf.DefaultMaxPolicy,
+		Suite:  suite.Default,
+		Clock:  meld.DefaultClock,
+		Leeway: meld.DefaultLeeway,
+	}
+
+	// Apply Options
+	for _, o := range opts {
+		o(&dopts)
+	}
+
+	// Decode and validate challenge
+	challengeRaw, envelope, err := openChallenge(principal, challenge, &dopts)
 	if err != nil {
 		return "", err
 	}
-	// Decode challenge
-	challengeRaw, err := fromOKP(challenge)
-	if err != nil {
-		return "", fmt.Errorf("anvil: Unable to decode challenge, %v", err)
+
+	// Seal a new verifier on server request
+	var upgrade []byte
+	if envelope.UpgradeKdf != "" {
+		params, err := verifierParams(envelope, &dopts)
+		if err != nil {
+			return "", err
+		}
+		if upgrade, err = sealUpgrade(ctx, principal, password, params, &dopts); err != nil {
+			return "", err
+		}
 	}
 
-	// Sign challenge with private key
-	signatureRaw := ed25519.Sign(priv, challengeRaw)
+	// Derive password to get keys
+	signer, err := derivePassword(ctx, []byte(principal), []byte(password), dopts.Salt, dopts.Realm, dopts.KDF, dopts.Suite, dopts.Progress)
+	if err != nil {
+		return "", err
+	}
+	defer signer.Wipe()
 
-	// Return token
-	return fmt.Sprintf("%s.%s.%s", toOKP(pub), challenge, toOKP(signatureRaw)), nil
+	// Sign challenge
+	return signChallenge(signer, principal, challengeRaw, upgrade, &dopts)
 }
 
 // Forge a challenge
@@ -56,6 +92,7 @@ func Forge(principal string, opts ...forge.Option) (string, string, error) {
 		IDGenerator: forge.DefaultSessionGenerator,
 		Expiration:  2 * time.Minute,
 		Encryptor:   forge.DefaultEncryptor,
+		Clock:       forge.DefaultClock,
 	}
 
 	// Apply param functions
@@ -63,12 +100,30 @@ func Forge(principal string, opts ...forge.Option) (string, string, error) {
 		o(dopts)
 	}
 
+	// Check FIPS profile
+	if dopts.FIPS {
+		if err := checkApproved(dopts.KDF, dopts.Suite); err != nil {
+			return "", "", err
+		}
+		if err := checkApprovedKeyring(dopts.Keyring); err != nil {
+			return "", "", err
+		}
+		dopts.Encryptor = dopts.Keyring.Encrypt
+	}
+
 	// Build the challenge
+	now := dopts.Clock()
 	challenge := internal.Challenge{
 		SessionId:  dopts.IDGenerator(),
 		Principal:  principal,
-		IssuedAt:   time.Now().UTC().Unix(),
-		Expiration: time.Now().Add(dopts.Expiration).UTC().Unix(),
+		IssuedAt:   now.UTC().Unix(),
+		Expiration: now.Add(dopts.Expiration).UTC().Unix(),
+		Issuer:     dopts.Issuer,
+		Audience:   dopts.Audience,
+		Claims:     dopts.Claims,
+	}
+	if dopts.NotBefore > 0 {
+		challenge.NotBefore = now.Add(dopts.NotBefore).UTC().Unix()
 	}
 
 	// Marshal challenge
@@ -83,15 +138,68 @@ func Forge(principal string, opts ...forge.Option) (string, string, error) {
 		return "", "", fmt.Errorf("anvil: Unable to encrypt challenge, %v", err)
 	}
 
+	// Wrap in envelope
+	envelope := internal.Envelope{
+		Payload: content,
+		Salt:    dopts.Salt,
+		Realm:   dopts.Realm,
+	}
+	if dopts.Suite != nil {
+		envelope.Suite = dopts.Suite.Name()
+	}
+
+	// Send derivation parameters to the client
+	if dopts.KDF.Algorithm != "" {
+		if err := dopts.KDF.Validate(); err != nil {
+			return "", "", fmt.Errorf("anvil: Invalid key derivation parameters, %v", err)
+		}
+		envelope.Kdf = dopts.KDF.String()
+	}
+
+	// Ask the client for a new verifier
+	if dopts.Upgrade.Algorithm != "" {
+		if err := dopts.Upgrade.Validate(); err != nil {
+			return "", "", fmt.Errorf("anvil: Invalid upgrade key derivation parameters, %v", err)
+		}
+		if dopts.FIPS {
+			if err := checkApproved(dopts.Upgrade, dopts.Suite); err != nil {
+				return "", "", err
+			}
+		}
+		envelope.UpgradeKdf = dopts.Upgrade.String()
+	}
+
+	// Authenticate challenge
+	if dopts.Authenticator != nil {
+		envelope.KeyId, envelope.Authenticator, err = dopts.Authenticator(authenticatedData(&envelope))
+		if err != nil {
+			return "", "", fmt.Errorf("anvil: Unable to authenticate challenge, %v", err)
+		}
+	}
+
+	// Marshal envelope
+	envelopeRaw, err := internal.Marshal(&envelope)
+	if err != nil {
+		return "", "", fmt.Errorf("anvil: Unable to marshal challenge envelope, %v", err)
+	}
+
+	// Register session once the challenge is built
+	if dopts.SessionStore != nil {
+		if err := dopts.SessionStore.Put(challenge.SessionId, challenge.Principal, time.Unix(challenge.Expiration, 0)); err != nil {
+			return "", "", fmt.Errorf("anvil: Unable to register challenge session, %v", err)
+		}
+	}
+
 	// Return challenge
-	return toOKP(content), challenge.SessionId, err
+	return toOKP(envelopeRaw), challenge.SessionId, err
 }
 
-// Tap checks for challenge
-func Tap(token string, opts ...tap.Option) (bool, string, string, error) {
+// Tap checks for challenge, a result is returned only for valid challenges.
+func Tap(token string, opts ...tap.Option) (*TapResult, error) {
 	// Default settings
 	dopts := tap.Options{
 		Decryptor: tap.DefaultDecryptor,
+		Clock:     tap.DefaultClock,
 	}
 
 	// Apply Options
@@ -99,56 +207,468 @@ func Tap(token string, opts ...tap.Option) (bool, string, string, error) {
 		o(&dopts)
 	}
 
-	// Split challenge in parts
-	parts := strings.SplitN(token, ".", 3)
+	// Decode token according to its version
+	t, err := parseToken(token, dopts.AllowLegacyTokens)
+	if err != nil {
+		return nil, err
+	}
+	if t.Version == resealV1 || t.Version == registerV1 {
+		return nil, fmt.Errorf("%w, '%s' messages are not login tokens", ErrUnsupportedToken, t.Version)
+	}
+
+	// Verify token
+	return verifyToken(t, &dopts)
+}
+
+// -----------------------------------------------------------------------------
+
+// Verify a decoded token, reseal or registration message
+func verifyToken(t *token, dopts *tap.Options) (*TapResult, error) {
+	var err error
+	tokenRaw := t.Challenge
+
+	// Check FIPS profile
+	if dopts.FIPS {
+		if t.Suite.Name() != suite.P256.Name() {
+			return nil, fmt.Errorf("%w, signature suite '%s'", ErrUnapprovedAlgorithm, t.Suite.Name())
+		}
+		if err = checkApprovedKeyring(dopts.Keyring); err != nil {
+			return nil, err
+		}
+		dopts.Decryptor = dopts.Keyring.Decrypt
+	}
+
+	// Public key could be omitted only when the server resolves them
+	if len(t.PublicKey) == 0 && dopts.PublicKeyResolver == nil && dopts.VerifierResolver == nil {
+		return nil, fmt.Errorf("%w, public key is required without resolver", ErrMalformedToken)
+	}
+	if len(t.PublicKey) > 0 {
+		if err = t.Suite.ValidatePublicKey(t.PublicKey); err != nil {
+			return nil, fmt.Errorf("%w, %v", ErrMalformedToken, err)
+		}
+	}
+	if len(t.Signature) != t.Suite.SignatureSize() {
+		return nil, fmt.Errorf("%w, invalid challenge signature size", ErrMalformedToken)
+	}
+
+	// Unmarshal envelope, legacy tokens carry the bare challenge
+	var envelope internal.Envelope
+	if t.Version == tokenLegacy {
+		envelope.Payload = tokenRaw
+	} else if err = internal.Unmarshal(tokenRaw, &envelope); err != nil {
+		return nil, fmt.Errorf("%w, unable to unmarshall challenge envelope: %v", ErrMalformedToken, err)
+	}
+
+	// Check server authenticator
+	if dopts.AuthenticatorVerifier != nil {
+		if len(envelope.Authenticator) == 0 {
+			return nil, ErrUnauthenticatedChallenge
+		}
+		if err = dopts.AuthenticatorVerifier(envelope.KeyId, authenticatedData(&envelope), envelope.Authenticator); err != nil {
+			return nil, fmt.Errorf("%w, %v", ErrUnauthenticatedChallenge, err)
+		}
+	}
+
+	// Preporcess challenge payload
+	content, err := dopts.Decryptor(envelope.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w, %v", ErrDecryptionFailed, err)
+	}
+
+	// Umarshal challenge
+	var challenge internal.Challenge
+	err = internal.Unmarshal(content, &challenge)
+	if err != nil {
+		return nil, fmt.Errorf("%w, unable to unmarshall challenge: %v", ErrMalformedToken, err)
+	}
+
+	// Check challenge validity period
+	now := dopts.Clock()
+	if challenge.IsExpired(now, dopts.Leeway) {
+		return nil, ErrExpiredChallenge
+	}
+	if challenge.IsIssuedInFuture(now, dopts.Leeway) {
+		return nil, ErrFutureChallenge
+	}
+	if challenge.IsNotYetValid(now, dopts.Leeway) {
+		return nil, ErrNotYetValidChallenge
+	}
+
+	// Check expected issuer and audience
+	if dopts.Issuer != "" && challenge.Issuer != dopts.Issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if dopts.Audience != "" && challenge.Audience != dopts.Audience {
+		return nil, ErrInvalidAudience
+	}
+
+	// Check custom claims
+	if dopts.ClaimsValidator != nil {
+		if err := dopts.ClaimsValidator(challenge.Claims); err != nil {
+			return nil, fmt.Errorf("%w, %v", ErrInvalidClaims, err)
+		}
+	}
+
+	// Check upgrade verifier
+	var upgrade *Verifier
+	if len(t.Upgrade) > 0 {
+		if upgrade, err = checkUpgrade(t.Upgrade, dopts); err != nil {
+			return nil, err
+		}
 
-	// Must have 3 parts (publicKey, challenge, signature)
-	if len(parts) != 3 {
-		return false, "", "", fmt.Errorf("anvil: Invalid challenge, it must contains 3 parts")
+		// Login token upgrade must be requested by the server
+		if t.Version == tokenV1 && upgrade.KDF.String() != envelope.UpgradeKdf {
+			return nil, fmt.Errorf("%w, unsolicited upgrade verifier", ErrMalformedToken)
+		}
 	}
 
-	// Decode PublicKey
-	publicKeyRaw, err := fromOKP(parts[0])
+	// Select signed message, legacy tokens sign the bare challenge
+	var message []byte
+	switch t.Version {
+	case tokenLegacy:
+		message = tokenRaw
+	case resealV1:
+		message = transcript(resealLabel, challenge.Principal, dopts.Origin, tokenRaw, t.Upgrade)
+	case registerV1:
+		message = transcript(registerLabel, challenge.Principal, dopts.Origin, tokenRaw, t.Upgrade)
+	default:
+		message = transcript(transcriptLabel, challenge.Principal, dopts.Origin, tokenRaw, t.Upgrade)
+	}
+
+	// Check signature
+	var match *registeredKey
+	if t.Version == registerV1 {
+		match, err = verifyPossession(t, message, upgrade)
+	} else {
+		match, err = verifySignature(t, message, challenge.Principal, dopts)
+	}
 	if err != nil {
-		return false, "", "", fmt.Errorf("anvil: Invalid public key, %v", err)
+		return nil, err
+	}
+
+	// Registered verifier must be approved
+	if dopts.FIPS && match.verifier != nil {
+		if err = checkApproved(match.verifier.KDF, match.verifier.Suite); err != nil {
+			return nil, err
+		}
 	}
-	if len(publicKeyRaw) != ed25519.PublicKeySize {
-		return false, "", "", fmt.Errorf("anvil: Invalid public key size")
+
+	// Consume session
+	if dopts.SessionStore != nil {
+		err := dopts.SessionStore.Consume(challenge.SessionId, challenge.Principal)
+		switch {
+		case errors.Is(err, session.ErrNotFound):
+			return nil, ErrConsumedChallenge
+		case err != nil:
+			return nil, fmt.Errorf("anvil: Unable to consume challenge session, %w", err)
+		}
+	}
+
+	// Valid challenge
+	result := &TapResult{
+		Principal:      challenge.Principal,
+		SessionID:      challenge.SessionId,
+		IssuedAt:       time.Unix(challenge.IssuedAt, 0).UTC(),
+		Expiration:     time.Unix(challenge.Expiration, 0).UTC(),
+		Issuer:         challenge.Issuer,
+		Audience:       challenge.Audience,
+		Claims:         challenge.Claims,
+		KeyFingerprint: fingerprint(match.publicKey),
 	}
 
+	// Flag outdated verifier
+	if match.verifier != nil {
+		result.Verifier = match.encoded
+		result.NeedsUpgrade = dopts.KDFPolicy != nil && match.verifier.CheckPolicy(dopts.KDFPolicy) != nil
+	}
+	if upgrade != nil && t.Version != registerV1 {
+		result.Upgrade = upgrade.String()
+	}
+
+	return result, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// Decode the challenge, validate it and apply derivation parameters sent by
+// the server.
+func openChallenge(principal, challenge string, opts *meld.Options) ([]byte, *internal.Envelope, error) {
 	// Decode challenge
-	tokenRaw, err := fromOKP(parts[1])
+	challengeRaw, err := fromOKP(challenge)
+	if err != nil {
+		return nil, nil, fmt.Errorf("anvil: Unable to decode challenge, %v", err)
+	}
+
+	// Unmarshal envelope
+	var envelope internal.Envelope
+	if err = internal.Unmarshal(challengeRaw, &envelope); err != nil {
+		return nil, nil, fmt.Errorf("anvil: Unable to unmarshall challenge envelope, %v", err)
+	}
+
+	// Validate challenge before signing it
+	if err = validateChallenge(principal, envelope.Payload, opts); err != nil {
+		return nil, nil, err
+	}
+
+	// Use derivation parameters sent by the server
+	if envelope.Kdf != "" {
+		if opts.KDF, err = kdf.Parse(envelope.Kdf); err != nil {
+			return nil, nil, fmt.Errorf("anvil: Invalid challenge key derivation parameters, %v", err)
+		}
+		if err = checkMaxKDF(opts.KDF, opts); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(envelope.Salt) > 0 {
+		opts.Salt = envelope.Salt
+	}
+	if envelope.Suite != "" {
+		if opts.Suite, err = suite.Lookup(envelope.Suite); err != nil {
+			return nil, nil, fmt.Errorf("anvil: Invalid challenge signature suite, %v", err)
+		}
+	}
+
+	// Check expected realm
+	if opts.Realm != "" && envelope.Realm != opts.Realm {
+		return nil, nil, ErrRealmMismatch
+	}
+	if opts.Realm == "" {
+		opts.Realm = envelope.Realm
+	}
+
+	// Check FIPS profile
+	if opts.FIPS {
+		if err = checkApproved(opts.KDF, opts.Suite); err != nil {
+			return nil, nil, err
+		}
+	}
+	if opts.Suite == nil {
+		return nil, nil, fmt.Errorf("anvil: Signature suite is required")
+	}
+
+	return challengeRaw, &envelope, nil
+}
+
+// Select the parameters of a new verifier, upgrade parameters requested by the
+// server take precedence.
+func verifierParams(envelope *internal.Envelope, opts *meld.Options) (kdf.Params, error) {
+	if envelope.UpgradeKdf == "" {
+		return opts.KDF, nil
+	}
+
+	params, err := kdf.Parse(envelope.UpgradeKdf)
 	if err != nil {
-		return false, "", "", fmt.Errorf("anvil: Unable to decode challenge, %v", err)
+		return kdf.Params{}, fmt.Errorf("anvil: Invalid challenge upgrade key derivation parameters, %v", err)
+	}
+	if err := checkMaxKDF(params, opts); err != nil {
+		return kdf.Params{}, err
+	}
+
+	return params, nil
+}
+
+// Server sent parameters must not exceed the client maximum costs
+func checkMaxKDF(params kdf.Params, opts *meld.Options) error {
+	if opts.MaxKDF == nil {
+		return nil
+	}
+	if err := opts.MaxKDF.CheckMax(params); err != nil {
+		return fmt.Errorf("%w, %v", ErrExcessiveKDF, err)
 	}
 
-	// Decode signature
-	signatureRaw, err := fromOKP(parts[2])
+	return nil
+}
+
+// Seal a new verifier with the given parameters, it keeps the signature suite
+// and realm with a fresh salt.
+func sealUpgrade(ctx context.Context, principal, password string, params kdf.Params, opts *meld.Options) ([]byte, error) {
+	upgrade, err := SealContext(ctx, principal, password, upgradeOptions(params, opts)...)
 	if err != nil {
-		return false, "", "", fmt.Errorf("anvil: Invalid challenge signature encoding, %v", err)
+		return nil, err
 	}
-	if len(signatureRaw) != ed25519.SignatureSize {
-		return false, "", "", fmt.Errorf("anvil: Invalid challenge signature size")
+
+	return []byte(upgrade), nil
+}
+
+// Seal options of a new verifier matching the challenge
+func upgradeOptions(params kdf.Params, opts *meld.Options) []seal.Option {
+	sealOpts := []seal.Option{}
+	if opts.FIPS {
+		sealOpts = append(sealOpts, seal.WithFIPS())
 	}
+	sealOpts = append(sealOpts,
+		seal.WithKDFParams(params),
+		seal.WithRealm(opts.Realm),
+		seal.WithSuite(opts.Suite),
+		seal.WithProgress(opts.Progress),
+	)
 
-	// Preporcess tokenRaw
-	content, err := dopts.Decryptor(tokenRaw)
+	return sealOpts
+}
+
+// Check the upgrade verifier sent by the client
+func checkUpgrade(encoded []byte, opts *tap.Options) (*Verifier, error) {
+	upgrade, err := ParseVerifier(string(encoded))
 	if err != nil {
-		return false, "", "", fmt.Errorf("anvil: Invalid challenge encoding, %v", err)
+		return nil, fmt.Errorf("%w, invalid upgrade verifier: %v", ErrMalformedToken, err)
 	}
 
-	// Umarshal challenge
+	// Check upgrade cost
+	if opts.KDFPolicy != nil {
+		if err := upgrade.CheckPolicy(opts.KDFPolicy); err != nil {
+			return nil, err
+		}
+	}
+	if opts.FIPS {
+		if err := checkApproved(upgrade.KDF, upgrade.Suite); err != nil {
+			return nil, err
+		}
+	}
+
+	return upgrade, nil
+}
+
+// Sign the challenge transcript and build the token
+func signChallenge(signer suite.Signer, principal string, challengeRaw, upgrade []byte, opts *meld.Options) (string, error) {
+	// Sign challenge transcript with private key
+	signatureRaw, err := signer.Sign(transcript(transcriptLabel, principal, opts.Origin, challengeRaw, upgrade))
+	if err != nil {
+		return "", fmt.Errorf("anvil: Unable to sign challenge, %v", err)
+	}
+
+	// Public key could be resolved by the server
+	pub := signer.PublicKey()
+	if opts.OmitPublicKey {
+		pub = nil
+	}
+
+	// Return token
+	return formatToken(tokenV1, opts.Suite, pub, challengeRaw, signatureRaw, upgrade), nil
+}
+
+func validateChallenge(principal string, payload []byte, opts *meld.Options) error {
+	// Opaque challenges must be bound to the origin
+	if opts.Opaque {
+		if opts.Origin == "" {
+			return ErrMissingOrigin
+		}
+		return nil
+	}
+
+	// Unmarshal challenge
 	var challenge internal.Challenge
-	err = internal.Unmarshal(content, &challenge)
+	if err := internal.Unmarshal(payload, &challenge); err != nil || challenge.SessionId == "" {
+		return ErrOpaqueChallenge
+	}
+
+	// Check challenge
+	if challenge.Principal != principal {
+		return ErrPrincipalMismatch
+	}
+	if challenge.IsExpired(opts.Clock(), opts.Leeway) {
+		return ErrExpiredChallenge
+	}
+	if opts.Audience != "" && challenge.Audience != opts.Audience {
+		return ErrInvalidAudience
+	}
+
+	return nil
+}
+
+// registeredKey is a resolved public key with its sealed verifier when known
+type registeredKey struct {
+	publicKey []byte
+	verifier  *Verifier
+	encoded   string
+}
+
+func verifySignature(t *token, message []byte, principal string, opts *tap.Options) (*registeredKey, error) {
+	// Without resolver, trust the embedded public key
+	if opts.PublicKeyResolver == nil && opts.VerifierResolver == nil {
+		if !t.Suite.Verify(t.PublicKey, message, t.Signature) {
+			return nil, ErrInvalidSignature
+		}
+		return &registeredKey{publicKey: t.PublicKey}, nil
+	}
+
+	// Resolve registered public keys
+	keys, err := resolvePublicKeys(t.Suite, principal, opts)
 	if err != nil {
-		return false, "", "", fmt.Errorf("anvil: Unable to unmarshall challenge, %v", err)
+		return nil, fmt.Errorf("%w, %v", ErrKeyResolution, err)
+	}
+
+	// Embedded public key must be registered
+	if len(t.PublicKey) > 0 {
+		var embedded []registeredKey
+		for _, key := range keys {
+			if bytes.Equal(key.publicKey, t.PublicKey) {
+				embedded = append(embedded, key)
+			}
+		}
+		if len(embedded) == 0 {
+			return nil, ErrUnregisteredPublicKey
+		}
+		keys = embedded
+	}
+
+	// Check signature with registered public keys
+	for i := range keys {
+		if t.Suite.Verify(keys[i].publicKey, message, t.Signature) {
+			return &keys[i], nil
+		}
+	}
+
+	// Invalid signature
+	return nil, ErrInvalidSignature
+}
+
+// Registration signature must be produced by the key sealed in the verifier
+func verifyPossession(t *token, message []byte, verifier *Verifier) (*registeredKey, error) {
+	if verifier == nil {
+		return nil, fmt.Errorf("%w, registration verifier is required", ErrMalformedToken)
+	}
+	if verifier.Suite.Name() != t.Suite.Name() || !bytes.Equal(verifier.PublicKey, t.PublicKey) {
+		return nil, fmt.Errorf("%w, public key does not match the registration verifier", ErrMalformedToken)
+	}
+	if !t.Suite.Verify(verifier.PublicKey, message, t.Signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	return &registeredKey{publicKey: verifier.PublicKey, verifier: verifier, encoded: verifier.String()}, nil
+}
+
+// Collect registered public keys of the given suite
+func resolvePublicKeys(s suite.Suite, principal string, opts *tap.Options) ([]registeredKey, error) {
+	var keys []registeredKey
+
+	// Ed25519 public keys
+	if opts.PublicKeyResolver != nil && s.Name() == suite.Ed25519.Name() {
+		publicKeys, err := opts.PublicKeyResolver(principal)
+		if err != nil {
+			return nil, err
+		}
+		for _, pub := range publicKeys {
+			keys = append(keys, registeredKey{publicKey: pub})
+		}
 	}
 
-	// Check challenge expiration
-	if challenge.IsExpired() {
-		return false, challenge.SessionId, challenge.Principal, ErrExpiredChallenge
+	// Sealed verifiers
+	if opts.VerifierResolver != nil {
+		verifiers, err := opts.VerifierResolver(principal)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range verifiers {
+			// Unparsable entries must not lock the principal out
+			verifier, err := ParseVerifier(value)
+			if err != nil {
+				continue
+			}
+			if verifier.Suite.Name() == s.Name() {
+				keys = append(keys, registeredKey{publicKey: verifier.PublicKey, verifier: verifier, encoded: value})
+			}
+		}
 	}
 
-	// Check ed25519 signature
-	return ed25519.Verify(publicKeyRaw[:], tokenRaw, signatureRaw), challenge.SessionId, challenge.Principal, nil
+	return keys, nil
 }
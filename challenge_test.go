@@ -19,13 +19,24 @@ package anvil_test
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"log"
+	"strings"
 	"testing"
+	"time"
 
-	"golang.org/x/crypto/salsa20"
+	"golang.org/x/crypto/ed25519"
 
 	"zntr.io/anvil"
 	"zntr.io/anvil/forge"
+	"zntr.io/anvil/internal"
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/keyring"
+	"zntr.io/anvil/meld"
+	"zntr.io/anvil/seal"
+	"zntr.io/anvil/session"
 	"zntr.io/anvil/tap"
 
 	. "github.com/onsi/gomega"
@@ -60,50 +71,31 @@ func TestFullChallenge(t *testing.T) {
 
 	log.Printf("Token : %s\n", token)
 
-	valid, sessionId, principal, err := anvil.Tap(token)
+	result, err := anvil.Tap(token)
 	Expect(err).To(BeNil(), "Error should be nil")
-	Expect(valid).To(BeTrue(), "Token tap should be true")
-	Expect(principal).To(Equal("toto"), "Principal should equal toto")
-	Expect(sessionId).ToNot(BeEmpty(), "Session identifier should not be empty")
+	Expect(result).ToNot(BeNil(), "Result should not be nil")
+	Expect(result.Principal).To(Equal("toto"), "Principal should equal toto")
+	Expect(result.SessionID).ToNot(BeEmpty(), "Session identifier should not be empty")
 
-	log.Printf("SessionID : %s\n", sessionId)
-	Expect(fsessionId).To(Equal(sessionId), "Session Id should be equal")
-	log.Printf("Principal : %s\n", principal)
-	Expect(principal).To(Equal("toto"), "Principal should equal given one")
+	log.Printf("SessionID : %s\n", result.SessionID)
+	Expect(fsessionId).To(Equal(result.SessionID), "Session Id should be equal")
+	log.Printf("Principal : %s\n", result.Principal)
+	Expect(result.Principal).To(Equal("toto"), "Principal should equal given one")
 }
 
 func TestChallengeEncryptor(t *testing.T) {
 	RegisterTestingT(t)
 
 	// Generate a random key
-	var key [32]byte
-	if _, err := rand.Read(key[:]); err != nil {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
 		t.Fail()
 	}
 
-	// Generate a nonce
-	nonce := make([]byte, 24)
-	if _, err := rand.Read(nonce); err != nil {
-		t.Fail()
-	}
-
-	encryptorFunc := func(data []byte) ([]byte, error) {
-		// Encrypt stream
-		out := make([]byte, len(data))
-		salsa20.XORKeyStream(out, data, nonce, &key)
-		// Return result
-		return out, nil
-	}
-
-	decryptorFunc := func(data []byte) ([]byte, error) {
-		// Decode stream
-		out := make([]byte, len(data))
-		salsa20.XORKeyStream(out, data, nonce, &key)
-		// Return result
-		return out, nil
-	}
+	kr, err := keyring.NewXChaCha20Poly1305("2020-06", key, 0)
+	Expect(err).To(BeNil(), "Error should be nil")
 
-	challenge, fsessionId, err := anvil.Forge("toto", forge.WithEncryptor(encryptorFunc))
+	challenge, fsessionId, err := anvil.Forge("toto", forge.WithEncryptor(kr.Encrypt))
 	Expect(err).To(BeNil(), "Error shoul be nil")
 	Expect(challenge).ToNot(BeNil(), "Challenge should not be nil")
 	Expect(challenge).ToNot(BeEmpty(), "Challenge should not be empty")
@@ -112,15 +104,663 @@ func TestChallengeEncryptor(t *testing.T) {
 	log.Printf("SessionID : %s\n", fsessionId)
 	log.Printf("Encrypted Challenge : %s\n", challenge)
 
-	// Challenge must be complete
-	token, err := anvil.Meld("toto", "foo", challenge)
+	// Challenge must be complete, opaque challenges are bound to the origin
+	token, err := anvil.Meld("toto", "foo", challenge, meld.WithOpaqueChallenge(), meld.WithOrigin("https://auth.example.com"))
 	Expect(err).To(BeNil(), "Error should be nil")
 	Expect(token).ToNot(BeNil(), "Token should not be nil")
 	Expect(token).ToNot(BeEmpty(), "Token should not be empty")
 
-	valid, sessionId, principal, err := anvil.Tap(token, tap.WithDecryptor(decryptorFunc))
+	result, err := anvil.Tap(token, tap.WithDecryptor(kr.Decrypt), tap.WithOrigin("https://auth.example.com"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result).ToNot(BeNil(), "Result should not be nil")
+	Expect(result.Principal).To(Equal("toto"), "Principal should equal toto")
+	Expect(result.SessionID).ToNot(BeEmpty(), "Session identifier should not be empty")
+}
+
+func TestPublicKeyResolver(t *testing.T) {
+	RegisterTestingT(t)
+
+	sealed, err := anvil.Seal("toto", "foo")
+	Expect(err).To(BeNil(), "Error should be nil")
+	verifier, err := anvil.ParseVerifier(sealed)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	resolver := func(principal string) ([]ed25519.PublicKey, error) {
+		if principal != "toto" {
+			return nil, errors.New("unknown principal")
+		}
+		return []ed25519.PublicKey{verifier.PublicKey}, nil
+	}
+
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// Registered public key
+	token, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err := anvil.Tap(token, tap.WithPublicKeyResolver(resolver))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result).ToNot(BeNil(), "Result should not be nil")
+	Expect(result.Principal).To(Equal("toto"), "Principal should equal toto")
+
+	// Omitted public key
+	token, err = anvil.Meld("toto", "foo", challenge, meld.WithoutPublicKey())
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err = anvil.Tap(token, tap.WithPublicKeyResolver(resolver))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result).ToNot(BeNil(), "Result should not be nil")
+
+	// Omitted public key without resolver
+	result, err = anvil.Tap(token)
+	Expect(err).To(MatchError(anvil.ErrMalformedToken), "Error should be malformed token")
+	Expect(result).To(BeNil(), "Result should be nil")
+
+	// Unregistered public key
+	token, err = anvil.Meld("toto", "bar", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err = anvil.Tap(token, tap.WithPublicKeyResolver(resolver))
+	Expect(err).To(MatchError(anvil.ErrUnregisteredPublicKey), "Error should be unregistered public key")
+	Expect(result).To(BeNil(), "Result should be nil")
+
+	// Omitted unregistered public key
+	token, err = anvil.Meld("toto", "bar", challenge, meld.WithoutPublicKey())
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err = anvil.Tap(token, tap.WithPublicKeyResolver(resolver))
+	Expect(err).To(MatchError(anvil.ErrInvalidSignature), "Error should be invalid signature")
+	Expect(result).To(BeNil(), "Result should be nil")
+}
+
+func TestChallengeAuthenticator(t *testing.T) {
+	RegisterTestingT(t)
+
+	// Generate a random key
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fail()
+	}
+
+	verifier := tap.HMACVerifier(map[string][]byte{
+		"2020-06": key,
+	})
+
+	// Authenticated challenge
+	challenge, _, err := anvil.Forge("toto", forge.WithAuthenticator(forge.HMACAuthenticator("2020-06", key)))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err := anvil.Tap(token, tap.WithAuthenticatorVerifier(verifier))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result).ToNot(BeNil(), "Result should not be nil")
+	Expect(result.Principal).To(Equal("toto"), "Principal should equal toto")
+
+	// Client minted challenge
+	challenge, _, err = anvil.Forge("toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err = anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err = anvil.Tap(token, tap.WithAuthenticatorVerifier(verifier))
+	Expect(err).To(MatchError(anvil.ErrUnauthenticatedChallenge), "Error should be unauthenticated challenge")
+	Expect(result).To(BeNil(), "Result should be nil")
+
+	// Unknown key identifier
+	challenge, _, err = anvil.Forge("toto", forge.WithAuthenticator(forge.HMACAuthenticator("2020-05", key)))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err = anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err = anvil.Tap(token, tap.WithAuthenticatorVerifier(verifier))
+	Expect(err).To(MatchError(anvil.ErrUnauthenticatedChallenge), "Error should be unauthenticated challenge")
+	Expect(result).To(BeNil(), "Result should be nil")
+
+	// Ed25519 server key
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	Expect(err).To(BeNil(), "Error should be nil")
+	challenge, _, err = anvil.Forge("toto", forge.WithAuthenticator(forge.Ed25519Authenticator("2020-06", priv)))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err = anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err = anvil.Tap(token, tap.WithAuthenticatorVerifier(tap.Ed25519Verifier(map[string]ed25519.PublicKey{
+		"2020-06": pub,
+	})))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result).ToNot(BeNil(), "Result should not be nil")
+}
+
+func TestChallengeAuthenticatorTampering(t *testing.T) {
+	RegisterTestingT(t)
+
+	// Generate a random key
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fail()
+	}
+
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+	registered, err := anvil.Seal("toto", "foo", seal.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+	verifier, err := anvil.ParseVerifier(registered)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	tamper := func(alter func(*internal.Envelope)) string {
+		challenge, _, err := anvil.Forge("toto",
+			forge.WithKDFParams(verifier.KDF),
+			forge.WithSalt(verifier.Salt),
+			forge.WithAuthenticator(forge.HMACAuthenticator("2020-06", key)),
+		)
+		Expect(err).To(BeNil(), "Error should be nil")
+
+		raw, err := base64.RawURLEncoding.DecodeString(challenge)
+		Expect(err).To(BeNil(), "Error should be nil")
+		var envelope internal.Envelope
+		Expect(internal.Unmarshal(raw, &envelope)).To(BeNil(), "Error should be nil")
+		alter(&envelope)
+		raw, err = internal.Marshal(&envelope)
+		Expect(err).To(BeNil(), "Error should be nil")
+
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+
+	options := []tap.Option{
+		tap.WithAuthenticatorVerifier(tap.HMACVerifier(map[string][]byte{
+			"2020-06": key,
+		})),
+		tap.WithVerifierResolver(func(principal string) ([]string, error) {
+			return []string{registered}, nil
+		}),
+	}
+
+	testCases := map[string]func(*internal.Envelope){
+		"upgrade kdf": func(e *internal.Envelope) { e.UpgradeKdf = "scrypt$ln=1,r=1,p=1" },
+		"kdf":         func(e *internal.Envelope) { e.Kdf = "scrypt$ln=1,r=1,p=1" },
+		"salt":        func(e *internal.Envelope) { e.Salt = []byte("attacker salt") },
+	}
+	for name, alter := range testCases {
+		token, err := anvil.Meld("toto", "foo", tamper(alter))
+		Expect(err).To(BeNil(), "Error should be nil for %s", name)
+		result, err := anvil.Tap(token, options...)
+		Expect(err).To(MatchError(anvil.ErrUnauthenticatedChallenge), "Tampered %s should be unauthenticated", name)
+		Expect(result).To(BeNil(), "Result should be nil")
+	}
+
+	// Untouched challenge
+	token, err := anvil.Meld("toto", "foo", tamper(func(*internal.Envelope) {}))
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Tap(token, options...)
+	Expect(err).To(BeNil(), "Error should be nil")
+}
+
+func TestChallengeReplay(t *testing.T) {
+	RegisterTestingT(t)
+
+	store := session.NewMemoryStore(time.Minute)
+
+	challenge, _, err := anvil.Forge("toto", forge.WithSessionStore(store))
 	Expect(err).To(BeNil(), "Error should be nil")
-	Expect(valid).To(BeTrue(), "Token tap should be true")
-	Expect(principal).To(Equal("toto"), "Principal should equal toto")
-	Expect(sessionId).ToNot(BeEmpty(), "Session identifier should not be empty")
+	token, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// First tap consumes the session
+	result, err := anvil.Tap(token, tap.WithSessionStore(store))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result).ToNot(BeNil(), "Result should not be nil")
+
+	// Replay
+	result, err = anvil.Tap(token, tap.WithSessionStore(store))
+	Expect(err).To(MatchError(anvil.ErrConsumedChallenge), "Error should be consumed challenge")
+	Expect(result).To(BeNil(), "Result should be nil")
+
+	// Unknown session
+	challenge, _, err = anvil.Forge("toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err = anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err = anvil.Tap(token, tap.WithSessionStore(store))
+	Expect(err).To(MatchError(anvil.ErrConsumedChallenge), "Error should be consumed challenge")
+	Expect(result).To(BeNil(), "Result should be nil")
+}
+
+func TestTapResult(t *testing.T) {
+	RegisterTestingT(t)
+
+	challenge, sessionID, err := anvil.Forge("toto", forge.WithExpiration(time.Minute))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	result, err := anvil.Tap(token)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result.Principal).To(Equal("toto"), "Principal should equal toto")
+	Expect(result.SessionID).To(Equal(sessionID), "Session Id should be equal")
+	Expect(result.Expiration.Sub(result.IssuedAt)).To(Equal(time.Minute), "Expiration should be issuance + 1min")
+
+	// Fingerprint is the SHA-256 of the public key
+	publicKey, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[2])
+	Expect(err).To(BeNil(), "Error should be nil")
+	h := sha256.Sum256(publicKey)
+	Expect(result.KeyFingerprint).To(Equal(base64.RawURLEncoding.EncodeToString(h[:])))
+}
+
+func TestTapErrors(t *testing.T) {
+	RegisterTestingT(t)
+
+	challenge, _, err := anvil.Forge("toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	parts := strings.Split(token, ".")[2:]
+
+	// Malformed tokens
+	for _, invalid := range []string{
+		"",
+		"a.b",
+		"anvil1.ed25519." + parts[0] + "." + parts[1],
+		"anvil1.ed25519.!!." + parts[1] + "." + parts[2],
+		"anvil1.ed25519." + parts[0] + ".!!." + parts[2],
+		"anvil1.ed25519." + parts[0] + "." + parts[1] + ".AAAA",
+		"anvil1.ed25519." + parts[0] + ".AAAA." + parts[2],
+	} {
+		result, err := anvil.Tap(invalid)
+		Expect(result).To(BeNil(), "Result should be nil")
+		Expect(errors.Is(err, anvil.ErrMalformedToken)).To(BeTrue(), "Error should be malformed token for '%s'", invalid)
+	}
+
+	// Bad signature
+	other, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	forged, _, err := anvil.Forge("toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err := anvil.Tap("anvil1.ed25519." + parts[0] + "." + forged + "." + strings.Split(other, ".")[4])
+	Expect(result).To(BeNil(), "Result should be nil")
+	Expect(errors.Is(err, anvil.ErrInvalidSignature)).To(BeTrue(), "Error should be invalid signature")
+
+	// Decryption failure
+	result, err = anvil.Tap(token, tap.WithDecryptor(func([]byte) ([]byte, error) {
+		return nil, errors.New("boom")
+	}))
+	Expect(result).To(BeNil(), "Result should be nil")
+	Expect(errors.Is(err, anvil.ErrDecryptionFailed)).To(BeTrue(), "Error should be decryption failed")
+
+	// Key resolution failure
+	result, err = anvil.Tap(token, tap.WithPublicKeyResolver(func(string) ([]ed25519.PublicKey, error) {
+		return nil, errors.New("boom")
+	}))
+	Expect(result).To(BeNil(), "Result should be nil")
+	Expect(errors.Is(err, anvil.ErrKeyResolution)).To(BeTrue(), "Error should be key resolution")
+
+	// Expired challenge
+	challenge, _, err = anvil.Forge("toto", forge.WithExpiration(-time.Minute))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err = anvil.Meld("toto", "foo", challenge, meld.WithLeeway(2*time.Minute))
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err = anvil.Tap(token)
+	Expect(result).To(BeNil(), "Result should be nil")
+	Expect(errors.Is(err, anvil.ErrExpiredChallenge)).To(BeTrue(), "Error should be expired challenge")
+}
+
+func TestTapClock(t *testing.T) {
+	RegisterTestingT(t)
+
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) func() time.Time {
+		return func() time.Time {
+			return now.Add(d)
+		}
+	}
+
+	challenge, _, err := anvil.Forge("toto", forge.WithClock(at(0)), forge.WithExpiration(2*time.Minute))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge, meld.WithClock(at(0)))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	result, err := anvil.Tap(token, tap.WithClock(at(time.Minute)))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result.IssuedAt).To(Equal(now), "Issuance should use forge clock")
+
+	// Expired
+	_, err = anvil.Tap(token, tap.WithClock(at(3*time.Minute)))
+	Expect(err).To(MatchError(anvil.ErrExpiredChallenge), "Error should be expired challenge")
+
+	// Expired within leeway
+	_, err = anvil.Tap(token, tap.WithClock(at(3*time.Minute)), tap.WithLeeway(2*time.Minute))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// Issued in the future
+	_, err = anvil.Tap(token, tap.WithClock(at(-time.Minute)))
+	Expect(err).To(MatchError(anvil.ErrFutureChallenge), "Error should be future challenge")
+
+	// Issued in the future within leeway
+	_, err = anvil.Tap(token, tap.WithClock(at(-time.Minute)), tap.WithLeeway(90*time.Second))
+	Expect(err).To(BeNil(), "Error should be nil")
+}
+
+func TestTapIssuerAudience(t *testing.T) {
+	RegisterTestingT(t)
+
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	challenge, _, err := anvil.Forge("toto",
+		forge.WithClock(clock),
+		forge.WithIssuer("https://staging.example.com"),
+		forge.WithAudience("api"),
+		forge.WithNotBefore(10*time.Second),
+	)
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge, meld.WithClock(clock), meld.WithAudience("api"))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	later := tap.WithClock(func() time.Time { return now.Add(30 * time.Second) })
+
+	result, err := anvil.Tap(token, later, tap.WithIssuer("https://staging.example.com"), tap.WithAudience("api"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result.Issuer).To(Equal("https://staging.example.com"))
+	Expect(result.Audience).To(Equal("api"))
+
+	// Production cluster
+	_, err = anvil.Tap(token, later, tap.WithIssuer("https://www.example.com"))
+	Expect(err).To(MatchError(anvil.ErrInvalidIssuer), "Error should be invalid issuer")
+
+	// Another audience
+	_, err = anvil.Tap(token, later, tap.WithAudience("admin"))
+	Expect(err).To(MatchError(anvil.ErrInvalidAudience), "Error should be invalid audience")
+
+	// Not yet valid
+	_, err = anvil.Tap(token, tap.WithClock(clock))
+	Expect(err).To(MatchError(anvil.ErrNotYetValidChallenge), "Error should be not yet valid")
+}
+
+func TestTapClaims(t *testing.T) {
+	RegisterTestingT(t)
+
+	challenge, _, err := anvil.Forge("toto",
+		forge.WithClaim("tenant", "acme"),
+		forge.WithClaim("client_ip", "192.0.2.1"),
+	)
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	requestIP := func(ip string) tap.Option {
+		return tap.WithClaimsValidator(func(claims map[string]string) error {
+			if claims["client_ip"] != ip {
+				return errors.New("client ip mismatch")
+			}
+			return nil
+		})
+	}
+
+	result, err := anvil.Tap(token, requestIP("192.0.2.1"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result.Claims).To(Equal(map[string]string{
+		"tenant":    "acme",
+		"client_ip": "192.0.2.1",
+	}))
+
+	// Request from another client
+	result, err = anvil.Tap(token, requestIP("198.51.100.7"))
+	Expect(err).To(MatchError(anvil.ErrInvalidClaims), "Error should be invalid claims")
+	Expect(result).To(BeNil(), "Result should be nil")
+}
+
+func TestMeldValidation(t *testing.T) {
+	RegisterTestingT(t)
+
+	challenge, _, err := anvil.Forge("toto", forge.WithAudience("https://auth.example.com"))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// Challenge forged for another principal
+	_, err = anvil.Meld("titi", "foo", challenge)
+	Expect(err).To(MatchError(anvil.ErrPrincipalMismatch), "Error should be principal mismatch")
+
+	// Challenge relayed from another service
+	_, err = anvil.Meld("toto", "foo", challenge, meld.WithAudience("https://phishing.example.com"))
+	Expect(err).To(MatchError(anvil.ErrInvalidAudience), "Error should be invalid audience")
+
+	// Expired challenge
+	_, err = anvil.Meld("toto", "foo", challenge, meld.WithClock(func() time.Time {
+		return time.Now().Add(time.Hour)
+	}))
+	Expect(err).To(MatchError(anvil.ErrExpiredChallenge), "Error should be expired challenge")
+
+	// Client clock skew within the default leeway
+	skewed := meld.WithClock(func() time.Time {
+		return time.Now().Add(2*time.Minute + 10*time.Second)
+	})
+	_, err = anvil.Meld("toto", "foo", challenge, skewed)
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Meld("toto", "foo", challenge, skewed, meld.WithLeeway(0))
+	Expect(err).To(MatchError(anvil.ErrExpiredChallenge), "Error should be expired challenge")
+
+	// Encrypted challenge
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fail()
+	}
+	kr, err := keyring.NewAES256GCM("2020-06", key, 0)
+	Expect(err).To(BeNil(), "Error should be nil")
+	challenge, _, err = anvil.Forge("toto", forge.WithEncryptor(kr.Encrypt))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	_, err = anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(MatchError(anvil.ErrOpaqueChallenge), "Error should be opaque challenge")
+	_, err = anvil.Meld("toto", "foo", challenge, meld.WithOpaqueChallenge())
+	Expect(err).To(MatchError(anvil.ErrMissingOrigin), "Error should be missing origin")
+
+	// Relayed opaque challenge is bound to the phishing origin
+	token, err := anvil.Meld("toto", "foo", challenge, meld.WithOpaqueChallenge(), meld.WithOrigin("https://phishing.example.com"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Tap(token, tap.WithDecryptor(kr.Decrypt), tap.WithOrigin("https://auth.example.com"))
+	Expect(err).To(MatchError(anvil.ErrInvalidSignature), "Error should be invalid signature")
+}
+
+func TestMeldTranscript(t *testing.T) {
+	RegisterTestingT(t)
+
+	challenge, _, err := anvil.Forge("toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	parts := strings.Split(token, ".")[2:]
+	publicKey, err := base64.RawURLEncoding.DecodeString(parts[0])
+	Expect(err).To(BeNil(), "Error should be nil")
+	challengeRaw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	Expect(err).To(BeNil(), "Error should be nil")
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// Raw challenge bytes must not be signed
+	Expect(ed25519.Verify(publicKey, challengeRaw, signature)).To(BeFalse(), "Raw challenge should not be signed")
+
+	// Transcript binds the origin
+	token, err = anvil.Meld("toto", "foo", challenge, meld.WithOrigin("https://auth.example.com"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Tap(token)
+	Expect(err).To(MatchError(anvil.ErrInvalidSignature), "Error should be invalid signature")
+	_, err = anvil.Tap(token, tap.WithOrigin("https://auth.example.com"))
+	Expect(err).To(BeNil(), "Error should be nil")
+}
+
+func TestTokenVersion(t *testing.T) {
+	RegisterTestingT(t)
+
+	challenge, _, err := anvil.Forge("toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(token).To(HavePrefix("anvil1.ed25519."), "Token should be versioned")
+
+	// Unknown version and algorithm
+	_, err = anvil.Tap("anvil9." + strings.Join(strings.Split(token, ".")[1:], "."))
+	Expect(err).To(MatchError(anvil.ErrUnsupportedToken), "Error should be unsupported token")
+	_, err = anvil.Tap("anvil1.rsa." + strings.Join(strings.Split(token, ".")[2:], "."))
+	Expect(err).To(MatchError(anvil.ErrUnsupportedToken), "Error should be unsupported token")
+	_, err = anvil.Tap("anvil1")
+	Expect(err).To(MatchError(anvil.ErrMalformedToken), "Error should be malformed token")
+}
+
+// legacyToken is a token produced by the unversioned implementation for
+// principal 'toto', it signs the bare challenge issued at legacyIssuedAt.
+const (
+	legacyToken    = "qrK4RAzbzEJ5w2wuObrFjNivdaI-mMoPJhqxRfkqDt0.CkBHMHVtSzZqbHBCU3FSUGJ6Q3VBdkdJb0lJbmJNQW9HaEdiWkluM3lVT3pjdnVNNU5tNnRpcm9pTnMwSHlXNnhtEIO60tYGGPu60tYGIgR0b3Rv.3kMdIiTnvqBikeYlky4UOo6ZWk-UYH9WhFwIcFNXYY9-RzS-ihhvS1Gh4QNlx3yTDtScM2pCtCwakYfibH-nCQ"
+	legacyIssuedAt = 1792318723
+)
+
+func TestLegacyToken(t *testing.T) {
+	RegisterTestingT(t)
+
+	clock := tap.WithClock(func() time.Time {
+		return time.Unix(legacyIssuedAt+30, 0)
+	})
+
+	// Legacy tokens must be allowed
+	_, err := anvil.Tap(legacyToken, clock)
+	Expect(err).To(MatchError(anvil.ErrUnsupportedToken), "Error should be unsupported token")
+
+	result, err := anvil.Tap(legacyToken, clock, tap.WithLegacyTokens())
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result.Principal).To(Equal("toto"), "Principal should equal toto")
+
+	// Registered public key
+	parts := strings.Split(legacyToken, ".")
+	pub, err := base64.RawURLEncoding.DecodeString(parts[0])
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Tap(legacyToken, clock, tap.WithLegacyTokens(), tap.WithPublicKeyResolver(func(principal string) ([]ed25519.PublicKey, error) {
+		return []ed25519.PublicKey{pub}, nil
+	}))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// Tampered signature
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	Expect(err).To(BeNil(), "Error should be nil")
+	sig[0] ^= 0x01
+	tampered := strings.Join([]string{parts[0], parts[1], base64.RawURLEncoding.EncodeToString(sig)}, ".")
+	_, err = anvil.Tap(tampered, clock, tap.WithLegacyTokens())
+	Expect(err).To(MatchError(anvil.ErrInvalidSignature), "Error should be invalid signature")
+
+	// Legacy challenges are not authenticated
+	_, err = anvil.Tap(legacyToken, clock, tap.WithLegacyTokens(), tap.WithAuthenticatorVerifier(tap.HMACVerifier(map[string][]byte{
+		"2020-06": []byte("secret"),
+	})))
+	Expect(err).To(MatchError(anvil.ErrUnauthenticatedChallenge), "Error should be unauthenticated challenge")
+
+	// Expired
+	_, err = anvil.Tap(legacyToken, tap.WithLegacyTokens(), tap.WithClock(func() time.Time {
+		return time.Unix(legacyIssuedAt+3600, 0)
+	}))
+	Expect(err).To(MatchError(anvil.ErrExpiredChallenge), "Error should be expired challenge")
+}
+
+func TestChallengeExcessiveKDF(t *testing.T) {
+	RegisterTestingT(t)
+
+	excessive := kdf.Params{Algorithm: kdf.Scrypt, LogN: 31, R: 8, P: 1}
+
+	// Derivation parameters
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(excessive))
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(MatchError(anvil.ErrExcessiveKDF), "Error should be raised")
+	_, err = anvil.Register("toto", "foo", challenge)
+	Expect(err).To(MatchError(anvil.ErrExcessiveKDF), "Error should be raised")
+
+	// Upgrade parameters
+	challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}), forge.WithUpgrade(excessive))
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(MatchError(anvil.ErrExcessiveKDF), "Error should be raised")
+	_, err = anvil.Reseal("toto", "foo", "bar", challenge)
+	Expect(err).To(MatchError(anvil.ErrExcessiveKDF), "Error should be raised")
+
+	// Client defined maximum
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 11, R: 8, P: 1}
+	challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Meld("toto", "foo", challenge, meld.WithMaxKDF(kdf.Policy{{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}}))
+	Expect(err).To(MatchError(anvil.ErrExcessiveKDF), "Error should be raised")
+	_, err = anvil.Meld("toto", "foo", challenge, meld.WithMaxKDF(kdf.Policy{params}))
+	Expect(err).To(BeNil(), "Error should be nil")
+}
+
+type failingStore struct {
+	err error
+}
+
+func (s failingStore) Put(sessionID, principal string, expiration time.Time) error {
+	return nil
+}
+
+func (s failingStore) Consume(sessionID, principal string) error {
+	return s.err
+}
+
+func TestChallengeSessionStoreClock(t *testing.T) {
+	RegisterTestingT(t)
+
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	store := session.NewMemoryStore(time.Minute, session.WithClock(clock))
+
+	// Sessions forged with a custom clock
+	challenge, _, err := anvil.Forge("toto", forge.WithSessionStore(store), forge.WithClock(clock))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge, meld.WithClock(clock))
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Tap(token, tap.WithSessionStore(store), tap.WithClock(clock))
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Tap(token, tap.WithSessionStore(store), tap.WithClock(clock))
+	Expect(err).To(MatchError(anvil.ErrConsumedChallenge), "Error should be consumed challenge")
+
+	// Storage failures are not consumed challenges
+	backendErr := errors.New("backend unavailable")
+	challenge, _, err = anvil.Forge("toto", forge.WithSessionStore(failingStore{err: backendErr}))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err = anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Tap(token, tap.WithSessionStore(failingStore{err: backendErr}))
+	Expect(err).To(MatchError(backendErr), "Error should wrap the storage failure")
+	Expect(errors.Is(err, anvil.ErrConsumedChallenge)).To(BeFalse(), "Error should not be consumed challenge")
+}
+
+func TestChallengeSessionStoreLeeway(t *testing.T) {
+	RegisterTestingT(t)
+
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	leeway := 30 * time.Second
+	store := session.NewMemoryStore(time.Minute, session.WithClock(clock), session.WithLeeway(leeway))
+
+	challenge, _, err := anvil.Forge("toto", forge.WithSessionStore(store), forge.WithClock(clock))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge, meld.WithClock(clock))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// Expired challenge tapped within the leeway
+	now = now.Add(2*time.Minute + 10*time.Second)
+	_, err = anvil.Tap(token, tap.WithSessionStore(store), tap.WithClock(clock), tap.WithLeeway(leeway))
+	Expect(err).To(BeNil(), "Error should be nil")
+}
+
+func TestChallengeSessionFailedForge(t *testing.T) {
+	RegisterTestingT(t)
+
+	store := session.NewMemoryStore(time.Minute)
+	sessionID := "123"
+
+	// Failed forge must not register the session
+	_, _, err := anvil.Forge("toto",
+		forge.WithSessionStore(store),
+		forge.WithSessionIDGenerator(func() string { return sessionID }),
+		forge.WithEncryptor(func([]byte) ([]byte, error) { return nil, errors.New("encryption failed") }),
+	)
+	Expect(err).ToNot(BeNil(), "Error should be raised")
+	Expect(store.Consume(sessionID, "toto")).To(Equal(session.ErrNotFound), "Session should not be registered")
+
+	// Same session identifier could be forged again
+	_, _, err = anvil.Forge("toto",
+		forge.WithSessionStore(store),
+		forge.WithSessionIDGenerator(func() string { return sessionID }),
+		forge.WithAuthenticator(func([]byte) (string, []byte, error) { return "", nil, errors.New("authentication failed") }),
+	)
+	Expect(err).ToNot(BeNil(), "Error should be raised")
+	Expect(store.Consume(sessionID, "toto")).To(Equal(session.ErrNotFound), "Session should not be registered")
 }
@@ -0,0 +1,171 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package anvil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/meld"
+	"zntr.io/anvil/seal"
+	"zntr.io/anvil/suite"
+)
+
+// Credentials holds a derived key pair, it could seal and meld many times
+// without deriving the password again. Wipe must be called once done.
+type Credentials struct {
+	mu        sync.RWMutex
+	principal string
+	kdf       kdf.Params
+	salt      []byte
+	realm     string
+	suite     suite.Suite
+	fips      bool
+	publicKey []byte
+	signer    suite.Signer
+}
+
+// Derive the principal / password credentials, seal options define the key
+// derivation parameters, a random salt is generated when none is given.
+func Derive(principal, password string, opts ...seal.Option) (*Credentials, error) {
+	return DeriveContext(context.Background(), principal, password, opts...)
+}
+
+// DeriveContext derives the principal / password credentials, password
+// derivation is aborted when the context is done.
+func DeriveContext(ctx context.Context, principal, password string, opts ...seal.Option) (*Credentials, error) {
+	// Default settings
+	dopts := seal.Options{
+		KDF:   kdf.DefaultParams,
+		Suite: suite.Default,
+	}
+
+	// Apply Options
+	for _, o := range opts {
+		o(&dopts)
+	}
+
+	// Check FIPS profile
+	if dopts.FIPS {
+		if err := checkApproved(dopts.KDF, dopts.Suite); err != nil {
+			return nil, err
+		}
+	}
+	if dopts.Suite == nil {
+		return nil, fmt.Errorf("anvil: Signature suite is required")
+	}
+
+	// Generate salt
+	if len(dopts.Salt) == 0 {
+		salt, err := randomSalt()
+		if err != nil {
+			return nil, err
+		}
+		dopts.Salt = salt
+	}
+
+	// Derive password to generate the key pair
+	signer, err := derivePassword(ctx, []byte(principal), []byte(password), dopts.Salt, dopts.Realm, dopts.KDF, dopts.Suite, dopts.Progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credentials{
+		principal: principal,
+		kdf:       dopts.KDF,
+		salt:      dopts.Salt,
+		realm:     dopts.Realm,
+		suite:     dopts.Suite,
+		fips:      dopts.FIPS,
+		publicKey: signer.PublicKey(),
+		signer:    signer,
+	}, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// PublicKey returns the derived public key
+func (c *Credentials) PublicKey() []byte {
+	return c.publicKey
+}
+
+// Seal returns the verifier matching the credentials
+func (c *Credentials) Seal() (string, error) {
+	return (&Verifier{
+		Suite:     c.suite,
+		KDF:       c.kdf,
+		Salt:      c.salt,
+		PublicKey: c.publicKey,
+	}).String(), nil
+}
+
+// Meld a challenge with the derived key pair, derivation parameters sent by
+// the server must match the credentials ones. Upgrade requests are ignored,
+// they require the password.
+func (c *Credentials) Meld(challenge string, opts ...meld.Option) (string, error) {
+	// Default settings
+	dopts := meld.Options{
+		KDF:    c.kdf,
+		MaxKDF: kdf.DefaultMaxPolicy,
+		Salt:   c.salt,
+		Suite:  c.suite,
+		FIPS:   c.fips,
+		Clock:  meld.DefaultClock,
+		Leeway: meld.DefaultLeeway,
+	}
+
+	// Apply Options
+	for _, o := range opts {
+		o(&dopts)
+	}
+
+	// Decode and validate challenge
+	challengeRaw, _, err := openChallenge(c.principal, challenge, &dopts)
+	if err != nil {
+		return "", err
+	}
+
+	// Credentials could not be derived again
+	if dopts.KDF != c.kdf || !bytes.Equal(dopts.Salt, c.salt) || dopts.Realm != c.realm || dopts.Suite.Name() != c.suite.Name() {
+		return "", ErrCredentialsMismatch
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.signer == nil {
+		return "", ErrWipedCredentials
+	}
+
+	// Sign challenge
+	return signChallenge(c.signer, c.principal, challengeRaw, nil, &dopts)
+}
+
+// Wipe zeroes the private key material, credentials could not meld after
+func (c *Credentials) Wipe() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.signer != nil {
+		c.signer.Wipe()
+		c.signer = nil
+	}
+}
@@ -0,0 +1,165 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package anvil_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"zntr.io/anvil"
+	"zntr.io/anvil/forge"
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/meld"
+	"zntr.io/anvil/seal"
+	"zntr.io/anvil/suite"
+	"zntr.io/anvil/tap"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCredentials(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+	salt := []byte("0123456789abcdef")
+
+	for _, s := range []suite.Suite{suite.Ed25519, suite.P256} {
+		creds, err := anvil.Derive("toto", "foo", seal.WithKDFParams(params), seal.WithSalt(salt), seal.WithSuite(s))
+		Expect(err).To(BeNil(), "Error should be nil")
+		Expect(creds.PublicKey()).ToNot(BeEmpty(), "PublicKey should not be blank")
+
+		// Seal matches the one-shot function
+		sealed, err := creds.Seal()
+		Expect(err).To(BeNil(), "Error should be nil")
+		expected, err := anvil.Seal("toto", "foo", seal.WithKDFParams(params), seal.WithSalt(salt), seal.WithSuite(s))
+		Expect(err).To(BeNil(), "Error should be nil")
+		Expect(sealed).To(Equal(expected), "Verifier should match")
+
+		resolver := tap.WithVerifierResolver(func(principal string) ([]string, error) {
+			return []string{sealed}, nil
+		})
+
+		// Meld many challenges without deriving again
+		for i := 0; i < 3; i++ {
+			challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(params), forge.WithSalt(salt), forge.WithSuite(s))
+			Expect(err).To(BeNil(), "Error should be nil")
+			token, err := creds.Meld(challenge)
+			Expect(err).To(BeNil(), "Error should be nil")
+			result, err := anvil.Tap(token, resolver)
+			Expect(err).To(BeNil(), "Error should be nil")
+			Expect(result.Principal).To(Equal("toto"))
+		}
+
+		// Challenge requiring another derivation
+		challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(params), forge.WithSalt([]byte("fedcba9876543210")), forge.WithSuite(s))
+		Expect(err).To(BeNil(), "Error should be nil")
+		_, err = creds.Meld(challenge)
+		Expect(err).To(MatchError(anvil.ErrCredentialsMismatch), "Error should be credentials mismatch")
+
+		challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(params), forge.WithSalt(salt), forge.WithSuite(s), forge.WithRealm("a.example.com"))
+		Expect(err).To(BeNil(), "Error should be nil")
+		_, err = creds.Meld(challenge)
+		Expect(err).To(MatchError(anvil.ErrCredentialsMismatch), "Error should be credentials mismatch")
+
+		// Challenge for another principal
+		challenge, _, err = anvil.Forge("titi", forge.WithKDFParams(params), forge.WithSalt(salt), forge.WithSuite(s))
+		Expect(err).To(BeNil(), "Error should be nil")
+		_, err = creds.Meld(challenge)
+		Expect(err).To(MatchError(anvil.ErrPrincipalMismatch), "Error should be principal mismatch")
+
+		// Wiped credentials
+		creds.Wipe()
+		creds.Wipe()
+		challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(params), forge.WithSalt(salt), forge.WithSuite(s))
+		Expect(err).To(BeNil(), "Error should be nil")
+		_, err = creds.Meld(challenge)
+		Expect(err).To(MatchError(anvil.ErrWipedCredentials), "Error should be wiped credentials")
+		Expect(creds.PublicKey()).To(Equal(expectedPublicKey(expected)), "PublicKey should remain available")
+	}
+
+	// Invalid parameters
+	_, err := anvil.Derive("toto", "foo", seal.WithKDFParams(kdf.Params{Algorithm: kdf.Scrypt}))
+	Expect(err).ToNot(BeNil(), "Error should not be nil")
+	_, err = anvil.Derive("toto", "foo", seal.WithKDFParams(params), seal.WithSuite(nil))
+	Expect(err).ToNot(BeNil(), "Error should not be nil")
+
+	// Missing suite in challenge and options
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(params), forge.WithSalt(salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Meld("toto", "foo", challenge, meld.WithSuite(nil))
+	Expect(err).ToNot(BeNil(), "Error should not be nil")
+
+	creds, err := anvil.Derive("toto", "foo", seal.WithKDFParams(params), seal.WithSalt(salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	defer creds.Wipe()
+	_, err = creds.Meld(challenge, meld.WithSuite(nil))
+	Expect(err).ToNot(BeNil(), "Error should not be nil")
+}
+
+func expectedPublicKey(sealed string) []byte {
+	verifier, err := anvil.ParseVerifier(sealed)
+	Expect(err).To(BeNil(), "Error should be nil")
+	return verifier.PublicKey
+}
+
+func TestDerivationContext(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 12, R: 8, P: 1}
+
+	// Progress reported
+	var reports []float64
+	sealed, err := anvil.SealContext(context.Background(), "toto", "foo", seal.WithKDFParams(params), seal.WithProgress(func(progress float64) {
+		reports = append(reports, progress)
+	}))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(len(reports)).To(BeNumerically(">=", 2), "Progress should be reported")
+	Expect(reports[0]).To(Equal(0.0), "First report should be 0")
+	Expect(reports[len(reports)-1]).To(Equal(1.0), "Last report should be 1")
+
+	verifier, err := anvil.ParseVerifier(sealed)
+	Expect(err).To(BeNil(), "Error should be nil")
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	reports = nil
+	token, err := anvil.MeldContext(context.Background(), "toto", "foo", challenge, meld.WithProgress(func(progress float64) {
+		reports = append(reports, progress)
+	}))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(reports).ToNot(BeEmpty(), "Progress should be reported")
+	_, err = anvil.Tap(token, tap.WithVerifierResolver(func(principal string) ([]string, error) {
+		return []string{sealed}, nil
+	}))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// Cancelled derivation
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = anvil.SealContext(ctx, "toto", "foo", seal.WithKDFParams(params))
+	Expect(errors.Is(err, context.Canceled)).To(BeTrue(), "Error should be context canceled")
+	_, err = anvil.DeriveContext(ctx, "toto", "foo", seal.WithKDFParams(params))
+	Expect(errors.Is(err, context.Canceled)).To(BeTrue(), "Error should be context canceled")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	_, err = anvil.MeldContext(ctx, "toto", "foo", challenge, meld.WithProgress(func(progress float64) {
+		cancel()
+	}))
+	Expect(errors.Is(err, context.Canceled)).To(BeTrue(), "Error should be context canceled")
+}
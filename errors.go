@@ -19,5 +19,51 @@ package anvil
 
 import "errors"
 
-// ErrExpiredChallenge raised when trying to tap an expired challenge
-var ErrExpiredChallenge = errors.New("anvil: Challenge is expired")
+var (
+	// ErrMalformedToken raised when the token or its challenge could not be decoded
+	ErrMalformedToken = errors.New("anvil: Malformed token")
+	// ErrUnsupportedToken raised when the token version or algorithm is not supported
+	ErrUnsupportedToken = errors.New("anvil: Unsupported token")
+	// ErrInvalidSignature raised when the challenge signature does not match the public key
+	ErrInvalidSignature = errors.New("anvil: Invalid challenge signature")
+	// ErrDecryptionFailed raised when the challenge decryptor fails
+	ErrDecryptionFailed = errors.New("anvil: Unable to decrypt challenge")
+	// ErrKeyResolution raised when the principal public keys could not be resolved
+	ErrKeyResolution = errors.New("anvil: Unable to resolve public keys")
+	// ErrExpiredChallenge raised when trying to tap an expired challenge
+	ErrExpiredChallenge = errors.New("anvil: Challenge is expired")
+	// ErrFutureChallenge raised when the challenge is issued in the future beyond the leeway
+	ErrFutureChallenge = errors.New("anvil: Challenge is issued in the future")
+	// ErrNotYetValidChallenge raised when the challenge not-before time is not reached
+	ErrNotYetValidChallenge = errors.New("anvil: Challenge is not yet valid")
+	// ErrInvalidIssuer raised when the challenge issuer does not match the expected one
+	ErrInvalidIssuer = errors.New("anvil: Challenge issuer does not match the expected one")
+	// ErrInvalidAudience raised when the challenge audience does not match the expected one
+	ErrInvalidAudience = errors.New("anvil: Challenge audience does not match the expected one")
+	// ErrInvalidClaims raised when the challenge custom claims are rejected by the validator
+	ErrInvalidClaims = errors.New("anvil: Challenge claims are invalid")
+	// ErrUnregisteredPublicKey raised when the token public key is not registered for the principal
+	ErrUnregisteredPublicKey = errors.New("anvil: Public key is not registered for principal")
+	// ErrUnauthenticatedChallenge raised when the challenge server authenticator is missing or invalid
+	ErrUnauthenticatedChallenge = errors.New("anvil: Challenge is not authenticated by server")
+	// ErrConsumedChallenge raised when the challenge session does not exist or has already been tapped
+	ErrConsumedChallenge = errors.New("anvil: Challenge session does not exist or has already been consumed")
+	// ErrRealmMismatch raised when melding a challenge forged for another realm
+	ErrRealmMismatch = errors.New("anvil: Challenge realm does not match the expected one")
+	// ErrPrincipalMismatch raised when melding a challenge forged for another principal
+	ErrPrincipalMismatch = errors.New("anvil: Challenge principal does not match")
+	// ErrOpaqueChallenge raised when melding a challenge which could not be validated
+	ErrOpaqueChallenge = errors.New("anvil: Challenge is opaque, it could not be validated")
+	// ErrMissingOrigin raised when melding an opaque challenge without origin binding
+	ErrMissingOrigin = errors.New("anvil: Opaque challenges require an origin binding")
+	// ErrUnapprovedAlgorithm raised when an algorithm is refused by the FIPS profile
+	ErrUnapprovedAlgorithm = errors.New("anvil: Algorithm is not approved by the FIPS profile")
+	// ErrCredentialsMismatch raised when melding a challenge requiring other derivation parameters than the credentials ones
+	ErrCredentialsMismatch = errors.New("anvil: Challenge derivation parameters do not match the credentials")
+	// ErrWipedCredentials raised when melding a challenge with wiped credentials
+	ErrWipedCredentials = errors.New("anvil: Credentials are wiped")
+	// ErrExcessiveKDF raised when the challenge key derivation cost exceeds the client maximum
+	ErrExcessiveKDF = errors.New("anvil: Challenge key derivation cost exceeds the client maximum")
+	// ErrWeakVerifier raised when the verifier key derivation cost is refused by the policy
+	ErrWeakVerifier = errors.New("anvil: Verifier key derivation cost is refused by policy")
+)
@@ -0,0 +1,51 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package anvil
+
+import (
+	"fmt"
+
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/keyring"
+	"zntr.io/anvil/suite"
+)
+
+// checkApproved refuses key derivation and signature algorithms not approved
+// by the FIPS profile, PBKDF2 implies SHA-256 password prehashing.
+func checkApproved(params kdf.Params, s suite.Suite) error {
+	if params.Algorithm != kdf.PBKDF2SHA256 {
+		return fmt.Errorf("%w, key derivation '%s'", ErrUnapprovedAlgorithm, params.Algorithm)
+	}
+	if s == nil || s.Name() != suite.P256.Name() {
+		return fmt.Errorf("%w, signature suite must be '%s'", ErrUnapprovedAlgorithm, suite.P256.Name())
+	}
+	return nil
+}
+
+// checkApprovedKeyring refuses keyrings holding non AES-GCM keys
+func checkApprovedKeyring(kr *keyring.Keyring) error {
+	if kr == nil {
+		return fmt.Errorf("%w, challenge encryption requires an AES-GCM keyring", ErrUnapprovedAlgorithm)
+	}
+	for _, alg := range kr.Algorithms() {
+		if alg != keyring.AES256GCM {
+			return fmt.Errorf("%w, challenge encryption '%s'", ErrUnapprovedAlgorithm, alg)
+		}
+	}
+	return nil
+}
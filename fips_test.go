@@ -0,0 +1,158 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package anvil_test
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"zntr.io/anvil"
+	"zntr.io/anvil/forge"
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/keyring"
+	"zntr.io/anvil/meld"
+	"zntr.io/anvil/seal"
+	"zntr.io/anvil/suite"
+	"zntr.io/anvil/tap"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestFIPSVectors(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.PBKDF2SHA256, Iterations: 10000}
+	salt := []byte("0123456789abcdef")
+
+	for _, vector := range []struct {
+		realm    string
+		expected string
+	}{
+		{"", "$anvil$v=1$p256$pbkdf2-sha256$i=10000$MDEyMzQ1Njc4OWFiY2RlZg$BEPQf8TWecLaQgZiTkeGe27-ghsqnpyFgt4C_sSZPQnU5-LWG_GRkrcuiro9-AEu_E5q7_XyaVnjpW8gXbFfCio"},
+		{"a.example.com", "$anvil$v=1$p256$pbkdf2-sha256$i=10000$MDEyMzQ1Njc4OWFiY2RlZg$BGCEdFuCB5VWXBAIfycSGC4JQRu_a_3Ssnzroq5eJ1O4LPIHQDI2zMKOu49EPkj-EVDgs0iRhYRPzu0PlvHzC5U"},
+	} {
+		sealed, err := anvil.Seal("toto", "foo", seal.WithFIPS(), seal.WithKDFParams(params), seal.WithSalt(salt), seal.WithRealm(vector.realm))
+		Expect(err).To(BeNil(), "Error should be nil")
+		Expect(sealed).To(Equal(vector.expected), "Verifier should match for realm '%s'", vector.realm)
+	}
+
+	// Default profile parameters
+	sealed, err := anvil.Seal("toto", "foo", seal.WithFIPS(), seal.WithSalt(salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(sealed).To(HavePrefix("$anvil$v=1$p256$pbkdf2-sha256$i=600000$"))
+}
+
+func TestFIPSRoundTrip(t *testing.T) {
+	RegisterTestingT(t)
+
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	Expect(err).To(BeNil(), "Error should be nil")
+	kr, err := keyring.NewAES256GCM("2020-06", key, 0)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	params := kdf.Params{Algorithm: kdf.PBKDF2SHA256, Iterations: 10000}
+	sealed, err := anvil.Seal("toto", "foo", seal.WithFIPS(), seal.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+	verifier, err := anvil.ParseVerifier(sealed)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	resolver := tap.WithVerifierResolver(func(principal string) ([]string, error) {
+		return []string{sealed}, nil
+	})
+
+	// Server sends approved parameters
+	challenge, _, err := anvil.Forge("toto", forge.WithFIPS(), forge.WithKeyring(kr), forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge, meld.WithFIPS(), meld.WithOpaqueChallenge(), meld.WithOrigin("https://auth.example.com"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(token).To(HavePrefix("anvil1.p256."), "Token should use P-256")
+	result, err := anvil.Tap(token, tap.WithFIPS(), tap.WithKeyring(kr), tap.WithOrigin("https://auth.example.com"), resolver)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result.Principal).To(Equal("toto"))
+
+	// Non-approved derivation sent by the server
+	challenge, _, err = anvil.Forge("toto", forge.WithKeyring(kr), forge.WithKDFParams(kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}))
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Meld("toto", "foo", challenge, meld.WithFIPS(), meld.WithOpaqueChallenge(), meld.WithOrigin("https://auth.example.com"))
+	Expect(err).To(MatchError(anvil.ErrUnapprovedAlgorithm), "Error should be unapproved algorithm")
+
+	// Non-approved token suite
+	challenge, _, err = anvil.Forge("toto", forge.WithKeyring(kr))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err = anvil.Meld("toto", "foo", challenge, meld.WithOpaqueChallenge(), meld.WithOrigin("https://auth.example.com"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Tap(token, tap.WithFIPS(), tap.WithKeyring(kr), tap.WithOrigin("https://auth.example.com"))
+	Expect(err).To(MatchError(anvil.ErrUnapprovedAlgorithm), "Error should be unapproved algorithm")
+}
+
+func TestFIPSRefusals(t *testing.T) {
+	RegisterTestingT(t)
+
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	Expect(err).To(BeNil(), "Error should be nil")
+	xkr, err := keyring.NewXChaCha20Poly1305("2020-06", key, 0)
+	Expect(err).To(BeNil(), "Error should be nil")
+	akr, err := keyring.NewAES256GCM("2020-06", key, 0)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// Non-approved derivation
+	_, err = anvil.Seal("toto", "foo", seal.WithFIPS(), seal.WithKDFParams(kdf.DefaultArgon2idParams))
+	Expect(err).To(MatchError(anvil.ErrUnapprovedAlgorithm), "Error should be unapproved algorithm")
+
+	// Non-approved suite
+	_, err = anvil.Seal("toto", "foo", seal.WithFIPS(), seal.WithSuite(nil))
+	Expect(err).To(MatchError(anvil.ErrUnapprovedAlgorithm), "Error should be unapproved algorithm")
+
+	// Challenge encryption
+	_, _, err = anvil.Forge("toto", forge.WithFIPS())
+	Expect(err).To(MatchError(anvil.ErrUnapprovedAlgorithm), "Error should be unapproved algorithm")
+	_, _, err = anvil.Forge("toto", forge.WithFIPS(), forge.WithKeyring(xkr))
+	Expect(err).To(MatchError(anvil.ErrUnapprovedAlgorithm), "Error should be unapproved algorithm")
+	_, _, err = anvil.Forge("toto", forge.WithFIPS(), forge.WithKeyring(akr), forge.WithKDFParams(kdf.DefaultParams))
+	Expect(err).To(MatchError(anvil.ErrUnapprovedAlgorithm), "Error should be unapproved algorithm")
+
+	// Challenge decryption
+	challenge, _, err := anvil.Forge("toto", forge.WithFIPS(), forge.WithKeyring(akr), forge.WithKDFParams(kdf.Params{Algorithm: kdf.PBKDF2SHA256, Iterations: 1000}))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge, meld.WithFIPS(), meld.WithOpaqueChallenge(), meld.WithOrigin("https://auth.example.com"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Tap(token, tap.WithFIPS(), tap.WithKeyring(xkr), tap.WithOrigin("https://auth.example.com"))
+	Expect(err).To(MatchError(anvil.ErrUnapprovedAlgorithm), "Error should be unapproved algorithm")
+	_, err = anvil.Tap(token, tap.WithFIPS(), tap.WithOrigin("https://auth.example.com"))
+	Expect(err).To(MatchError(anvil.ErrUnapprovedAlgorithm), "Error should be unapproved algorithm")
+
+	// Registered verifier derivation
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+	registered, err := anvil.Seal("toto", "foo", seal.WithSuite(suite.P256), seal.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+	verifier, err := anvil.ParseVerifier(registered)
+	Expect(err).To(BeNil(), "Error should be nil")
+	challenge, _, err = anvil.Forge("toto", forge.WithKeyring(akr), forge.WithSuite(suite.P256), forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err = anvil.Meld("toto", "foo", challenge, meld.WithOpaqueChallenge(), meld.WithOrigin("https://auth.example.com"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	resolver := tap.WithVerifierResolver(func(principal string) ([]string, error) {
+		return []string{registered}, nil
+	})
+	_, err = anvil.Tap(token, tap.WithKeyring(akr), tap.WithOrigin("https://auth.example.com"), resolver)
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Tap(token, tap.WithFIPS(), tap.WithKeyring(akr), tap.WithOrigin("https://auth.example.com"), resolver)
+	Expect(err).To(MatchError(anvil.ErrUnapprovedAlgorithm), "Error should be unapproved algorithm")
+}
@@ -0,0 +1,58 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package forge
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// AuthenticatorFunc is the contract for challenge server authentication, the
+// payload covers the challenge and the derivation parameters of the envelope.
+type AuthenticatorFunc func(payload []byte) (keyID string, tag []byte, err error)
+
+// HMACAuthenticator authenticates challenges using HMAC-SHA256 with the given key
+func HMACAuthenticator(keyID string, key []byte) AuthenticatorFunc {
+	return func(payload []byte) (string, []byte, error) {
+		if len(key) == 0 {
+			return "", nil, errors.New("forge: HMAC key must not be empty")
+		}
+
+		// Compute payload MAC
+		h := hmac.New(sha256.New, key)
+		h.Write(payload)
+
+		// Return authenticator
+		return keyID, h.Sum(nil), nil
+	}
+}
+
+// Ed25519Authenticator authenticates challenges using an Ed25519 server key
+func Ed25519Authenticator(keyID string, key ed25519.PrivateKey) AuthenticatorFunc {
+	return func(payload []byte) (string, []byte, error) {
+		if len(key) != ed25519.PrivateKeySize {
+			return "", nil, errors.New("forge: Invalid Ed25519 private key size")
+		}
+
+		// Return authenticator
+		return keyID, ed25519.Sign(key, payload), nil
+	}
+}
@@ -21,20 +21,42 @@ import (
 	"time"
 
 	"github.com/dchest/uniuri"
+
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/keyring"
+	"zntr.io/anvil/session"
+	"zntr.io/anvil/suite"
 )
 
 // SessionIDGeneratorFunc is the contract for Session ID generation implementation
 type SessionIDGeneratorFunc func() string
 
+// ClockFunc is the contract for current time provider
+type ClockFunc func() time.Time
+
 // ProcessorFunc contract for challenge pre/post processing
 type ProcessorFunc func([]byte) ([]byte, error)
 
 // Options for challenge forging
 type Options struct {
-	Expiration  time.Duration
-	IDGenerator SessionIDGeneratorFunc
-	Encryptor   ProcessorFunc
-	Decryptor   ProcessorFunc
+	Expiration    time.Duration
+	IDGenerator   SessionIDGeneratorFunc
+	Encryptor     ProcessorFunc
+	Decryptor     ProcessorFunc
+	Authenticator AuthenticatorFunc
+	SessionStore  session.Store
+	KDF           kdf.Params
+	Salt          []byte
+	Realm         string
+	Suite         suite.Suite
+	Keyring       *keyring.Keyring
+	Upgrade       kdf.Params
+	FIPS          bool
+	Clock         ClockFunc
+	Issuer        string
+	Audience      string
+	NotBefore     time.Duration
+	Claims        map[string]string
 }
 
 // Option defines forge option contract option function
@@ -75,6 +97,116 @@ func WithDecryptor(decryptor ProcessorFunc) Option {
 	}
 }
 
+// WithAuthenticator defines the challenge server authenticator
+func WithAuthenticator(authenticator AuthenticatorFunc) Option {
+	return func(opts *Options) {
+		opts.Authenticator = authenticator
+	}
+}
+
+// WithSessionStore defines the store used to register forged sessions
+func WithSessionStore(store session.Store) Option {
+	return func(opts *Options) {
+		opts.SessionStore = store
+	}
+}
+
+// WithKDFParams defines the principal sealed key derivation parameters sent
+// to the client with the challenge
+func WithKDFParams(params kdf.Params) Option {
+	return func(opts *Options) {
+		opts.KDF = params
+	}
+}
+
+// WithSalt defines the principal sealed salt sent to the client with the challenge
+func WithSalt(salt []byte) Option {
+	return func(opts *Options) {
+		opts.Salt = salt
+	}
+}
+
+// WithRealm defines the application realm sent to the client with the challenge
+func WithRealm(realm string) Option {
+	return func(opts *Options) {
+		opts.Realm = realm
+	}
+}
+
+// WithClock defines the time provider used for challenge issuance
+func WithClock(clock ClockFunc) Option {
+	return func(opts *Options) {
+		opts.Clock = clock
+	}
+}
+
+// WithIssuer defines the challenge issuer
+func WithIssuer(issuer string) Option {
+	return func(opts *Options) {
+		opts.Issuer = issuer
+	}
+}
+
+// WithAudience defines the challenge audience
+func WithAudience(audience string) Option {
+	return func(opts *Options) {
+		opts.Audience = audience
+	}
+}
+
+// WithNotBefore defines the delay after issuance before the challenge becomes valid
+func WithNotBefore(delay time.Duration) Option {
+	return func(opts *Options) {
+		opts.NotBefore = delay
+	}
+}
+
+// WithClaim adds a custom claim to the challenge
+func WithClaim(key, value string) Option {
+	return func(opts *Options) {
+		if opts.Claims == nil {
+			opts.Claims = map[string]string{}
+		}
+		opts.Claims[key] = value
+	}
+}
+
+// WithSuite defines the principal sealed signature suite sent to the client
+// with the challenge
+func WithSuite(s suite.Suite) Option {
+	return func(opts *Options) {
+		opts.Suite = s
+	}
+}
+
+// WithUpgrade asks the client to seal a new verifier with the given key
+// derivation parameters, it must be used when the principal verifier is
+// outdated.
+func WithUpgrade(params kdf.Params) Option {
+	return func(opts *Options) {
+		opts.Upgrade = params
+	}
+}
+
+// WithKeyring defines the keyring used to encrypt challenges
+func WithKeyring(kr *keyring.Keyring) Option {
+	return func(opts *Options) {
+		opts.Keyring = kr
+		opts.Encryptor = kr.Encrypt
+	}
+}
+
+// WithFIPS enables the FIPS profile, it sends PBKDF2-HMAC-SHA256 and ECDSA
+// P-256 parameters by default and refuses non-approved algorithms. Challenges
+// must be encrypted with an AES-GCM keyring.
+func WithFIPS() Option {
+	return func(opts *Options) {
+		opts.FIPS = true
+		opts.KDF = kdf.DefaultPBKDF2Params
+		opts.Suite = suite.P256
+	}
+}
+
 var (
 	// DefaultSessionGenerator defines the default session id generator
 	DefaultSessionGenerator = func() string {
@@ -88,4 +220,7 @@ var (
 
 	// DefaultEncryptor is the default data encryptor for challenge
 	DefaultEncryptor = NoOperationProcessor
+
+	// DefaultClock is the default time provider
+	DefaultClock = time.Now
 )
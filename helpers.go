@@ -18,41 +18,171 @@
 package anvil
 
 import (
-	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"fmt"
-	"math"
 
 	"golang.org/x/crypto/blake2s"
-	"golang.org/x/crypto/ed25519"
-	"golang.org/x/crypto/scrypt"
+
+	"zntr.io/anvil/internal"
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/suite"
+)
+
+const (
+	saltSize          = 16
+	transcriptLabel   = "zntr.io/anvil/meld"
+	resealLabel       = "zntr.io/anvil/reseal"
+	registerLabel     = "zntr.io/anvil/register"
+	envelopeLabel     = "zntr.io/anvil/envelope"
+	transcriptVersion = 1
 )
 
-// Derive password using Blake2s+scrypt as HKDF
-func derivePassword(principal, password []byte) (ed25519.PublicKey, ed25519.PrivateKey, error) {
-	// Hash password using Blake2s (32byte)
-	key := blake2s.Sum256([]byte(password))
-	salt := []byte(principal)
-	N := int(math.Pow(2, 17)) // CPU/Cost
-	r := 8
-	p := 1
-	keyLen := 64
-
-	// Prepare scrypt derivation for Ed25519 key generation
-	keyRaw, err := scrypt.Key(key[:], salt, N, r, p, keyLen)
+// Derive password using Blake2s+KDF as HKDF, principal is used as salt when
+// none is given. The realm keys the password hash for domain separation.
+// Derived key material is turned into a key pair by the signature suite.
+func derivePassword(ctx context.Context, principal, password, salt []byte, realm string, params kdf.Params, s suite.Suite, progress kdf.ProgressFunc) (suite.Signer, error) {
+	// Hash password (32byte)
+	key, err := prehash(password, realm, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(salt) == 0 {
+		salt = principal
+	}
+
+	// Wait for derivation budget, it is held until the derivation is over
+	var release func()
+	if l := derivationLimiter(); l != nil {
+		if release, err = l.Acquire(ctx, params.MemoryCost()); err != nil {
+			wipe(key)
+			return nil, fmt.Errorf("anvil: Unable to derive password, %w", err)
+		}
+	}
+
+	// Prepare derivation for key generation
+	keyRaw, err := params.KeyContextDone(ctx, key, salt, suite.MaterialSize, progress, release)
+	wipe(key)
 	if err != nil {
-		return nil, nil, fmt.Errorf("anvil: Unable to derive password, scrypt error: %v", err)
+		return nil, fmt.Errorf("anvil: Unable to derive password, %w", err)
 	}
+	defer wipe(keyRaw)
 
-	// Build ed25519 keys
-	read := bytes.NewReader(keyRaw)
-	pub, priv, err := ed25519.GenerateKey(read)
+	// Build suite keys
+	signer, err := s.DeriveKey(keyRaw)
 	if err != nil {
-		return nil, nil, fmt.Errorf("anvil: Unable to generate Ed25519 key pair, %v", err)
+		return nil, fmt.Errorf("anvil: Unable to generate %s key pair, %v", s.Name(), err)
 	}
 
 	// Return keys
-	return pub, priv, nil
+	return signer, nil
+}
+
+// Hash the password before key derivation, PBKDF2 uses approved SHA-256 /
+// HMAC-SHA256 primitives, others use Blake2s.
+func prehash(password []byte, realm string, params kdf.Params) ([]byte, error) {
+	if params.Algorithm == kdf.PBKDF2SHA256 {
+		if realm == "" {
+			key := sha256.Sum256(password)
+			return key[:], nil
+		}
+		realmKey := sha256.Sum256([]byte(realm))
+		h := hmac.New(sha256.New, realmKey[:])
+		h.Write(password)
+		return h.Sum(nil), nil
+	}
+
+	if realm == "" {
+		key := blake2s.Sum256(password)
+		return key[:], nil
+	}
+	realmKey := blake2s.Sum256([]byte(realm))
+	h, err := blake2s.New256(realmKey[:])
+	if err != nil {
+		return nil, fmt.Errorf("anvil: Unable to initialize realm hash, %v", err)
+	}
+	h.Write(password)
+	return h.Sum(nil), nil
+}
+
+// Zero the given buffer
+func wipe(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
+
+// Generate a random salt
+func randomSalt() ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("anvil: Unable to generate salt, %v", err)
+	}
+	return salt, nil
+}
+
+// Build the signed transcript, fields are length prefixed to prevent
+// ambiguous concatenations:
+//
+//	label || version || principal || origin || SHA-256(challenge) [|| upgrade]
+//
+// The upgrade verifier is only appended when present, the label separates
+// login tokens from reseal messages.
+func transcript(label, principal, origin string, challenge, upgrade []byte) []byte {
+	challengeHash := sha256.Sum256(challenge)
+
+	fields := [][]byte{
+		[]byte(label),
+		{transcriptVersion},
+		[]byte(principal),
+		[]byte(origin),
+		challengeHash[:],
+	}
+	if len(upgrade) > 0 {
+		fields = append(fields, upgrade)
+	}
+
+	return encodeFields(fields)
+}
+
+// Build the data authenticated by the server, it covers the challenge payload
+// and all the derivation parameters sent to the client:
+//
+//	label || version || payload || kdf || salt || realm || suite || upgrade kdf
+func authenticatedData(envelope *internal.Envelope) []byte {
+	return encodeFields([][]byte{
+		[]byte(envelopeLabel),
+		{transcriptVersion},
+		envelope.Payload,
+		[]byte(envelope.Kdf),
+		envelope.Salt,
+		[]byte(envelope.Realm),
+		[]byte(envelope.Suite),
+		[]byte(envelope.UpgradeKdf),
+	})
+}
+
+// Concatenate length prefixed fields
+func encodeFields(fields [][]byte) []byte {
+	var out []byte
+	for _, field := range fields {
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(field)))
+		out = append(out, length[:]...)
+		out = append(out, field...)
+	}
+
+	return out
+}
+
+// Compute public key fingerprint
+func fingerprint(publicKey []byte) string {
+	h := sha256.Sum256(publicKey)
+	return toOKP(h[:])
 }
 
 // Export as OKP representation
@@ -19,7 +19,17 @@ package internal
 
 import "time"
 
-// IsExpired retruns the challenge expiration status
-func (ch *Challenge) IsExpired() bool {
-	return time.Now().UTC().After(time.Unix(ch.Expiration, 0).UTC())
+// IsExpired retruns the challenge expiration status at the given time
+func (ch *Challenge) IsExpired(now time.Time, leeway time.Duration) bool {
+	return now.UTC().After(time.Unix(ch.Expiration, 0).UTC().Add(leeway))
+}
+
+// IsIssuedInFuture returns true when the challenge issuance is after the given time
+func (ch *Challenge) IsIssuedInFuture(now time.Time, leeway time.Duration) bool {
+	return time.Unix(ch.IssuedAt, 0).UTC().After(now.UTC().Add(leeway))
+}
+
+// IsNotYetValid returns true when the challenge not-before time is after the given time
+func (ch *Challenge) IsNotYetValid(now time.Time, leeway time.Duration) bool {
+	return ch.NotBefore != 0 && time.Unix(ch.NotBefore, 0).UTC().After(now.UTC().Add(leeway))
 }
@@ -24,13 +24,17 @@ const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
 // Challenge is the authentication challenge to be used by client
 type Challenge struct {
-	SessionId            string   `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
-	IssuedAt             int64    `protobuf:"varint,2,opt,name=issued_at,json=issuedAt,proto3" json:"issued_at,omitempty"`
-	Expiration           int64    `protobuf:"varint,3,opt,name=expiration,proto3" json:"expiration,omitempty"`
-	Principal            string   `protobuf:"bytes,4,opt,name=principal,proto3" json:"principal,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	SessionId            string            `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	IssuedAt             int64             `protobuf:"varint,2,opt,name=issued_at,json=issuedAt,proto3" json:"issued_at,omitempty"`
+	Expiration           int64             `protobuf:"varint,3,opt,name=expiration,proto3" json:"expiration,omitempty"`
+	Principal            string            `protobuf:"bytes,4,opt,name=principal,proto3" json:"principal,omitempty"`
+	Issuer               string            `protobuf:"bytes,5,opt,name=issuer,proto3" json:"issuer,omitempty"`
+	Audience             string            `protobuf:"bytes,6,opt,name=audience,proto3" json:"audience,omitempty"`
+	NotBefore            int64             `protobuf:"varint,7,opt,name=not_before,json=notBefore,proto3" json:"not_before,omitempty"`
+	Claims               map[string]string `protobuf:"bytes,8,rep,name=claims,proto3" json:"claims,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
 }
 
 func (m *Challenge) Reset()         { *m = Challenge{} }
@@ -86,8 +90,134 @@ func (m *Challenge) GetPrincipal() string {
 	return ""
 }
 
+func (m *Challenge) GetIssuer() string {
+	if m != nil {
+		return m.Issuer
+	}
+	return ""
+}
+
+func (m *Challenge) GetAudience() string {
+	if m != nil {
+		return m.Audience
+	}
+	return ""
+}
+
+func (m *Challenge) GetNotBefore() int64 {
+	if m != nil {
+		return m.NotBefore
+	}
+	return 0
+}
+
+func (m *Challenge) GetClaims() map[string]string {
+	if m != nil {
+		return m.Claims
+	}
+	return nil
+}
+
+// Envelope is the server authenticated challenge container
+type Envelope struct {
+	Payload              []byte   `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	KeyId                string   `protobuf:"bytes,2,opt,name=key_id,json=keyId,proto3" json:"key_id,omitempty"`
+	Authenticator        []byte   `protobuf:"bytes,3,opt,name=authenticator,proto3" json:"authenticator,omitempty"`
+	Kdf                  string   `protobuf:"bytes,4,opt,name=kdf,proto3" json:"kdf,omitempty"`
+	Salt                 []byte   `protobuf:"bytes,5,opt,name=salt,proto3" json:"salt,omitempty"`
+	Realm                string   `protobuf:"bytes,6,opt,name=realm,proto3" json:"realm,omitempty"`
+	Suite                string   `protobuf:"bytes,7,opt,name=suite,proto3" json:"suite,omitempty"`
+	UpgradeKdf           string   `protobuf:"bytes,8,opt,name=upgrade_kdf,json=upgradeKdf,proto3" json:"upgrade_kdf,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Envelope) Reset()         { *m = Envelope{} }
+func (m *Envelope) String() string { return proto.CompactTextString(m) }
+func (*Envelope) ProtoMessage()    {}
+func (*Envelope) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d938547f84707355, []int{1}
+}
+
+func (m *Envelope) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Envelope.Unmarshal(m, b)
+}
+func (m *Envelope) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Envelope.Marshal(b, m, deterministic)
+}
+func (m *Envelope) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Envelope.Merge(m, src)
+}
+func (m *Envelope) XXX_Size() int {
+	return xxx_messageInfo_Envelope.Size(m)
+}
+func (m *Envelope) XXX_DiscardUnknown() {
+	xxx_messageInfo_Envelope.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Envelope proto.InternalMessageInfo
+
+func (m *Envelope) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *Envelope) GetKeyId() string {
+	if m != nil {
+		return m.KeyId
+	}
+	return ""
+}
+
+func (m *Envelope) GetAuthenticator() []byte {
+	if m != nil {
+		return m.Authenticator
+	}
+	return nil
+}
+
+func (m *Envelope) GetKdf() string {
+	if m != nil {
+		return m.Kdf
+	}
+	return ""
+}
+
+func (m *Envelope) GetSalt() []byte {
+	if m != nil {
+		return m.Salt
+	}
+	return nil
+}
+
+func (m *Envelope) GetRealm() string {
+	if m != nil {
+		return m.Realm
+	}
+	return ""
+}
+
+func (m *Envelope) GetSuite() string {
+	if m != nil {
+		return m.Suite
+	}
+	return ""
+}
+
+func (m *Envelope) GetUpgradeKdf() string {
+	if m != nil {
+		return m.UpgradeKdf
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*Challenge)(nil), "internal.Challenge")
+	proto.RegisterMapType((map[string]string)(nil), "internal.Challenge.ClaimsEntry")
+	proto.RegisterType((*Envelope)(nil), "internal.Envelope")
 }
 
 func init() {
@@ -95,15 +225,29 @@ func init() {
 }
 
 var fileDescriptor_d938547f84707355 = []byte{
-	// 156 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x2e, 0xa9, 0x2c, 0x48,
-	0x2d, 0xd6, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0xc8, 0xcc, 0x2b, 0x49, 0x2d, 0xca, 0x4b,
-	0xcc, 0x51, 0x6a, 0x65, 0xe4, 0xe2, 0x74, 0xce, 0x48, 0xcc, 0xc9, 0x49, 0xcd, 0x4b, 0x4f, 0x15,
-	0x92, 0xe5, 0xe2, 0x2a, 0x4e, 0x2d, 0x2e, 0xce, 0xcc, 0xcf, 0x8b, 0xcf, 0x4c, 0x91, 0x60, 0x54,
-	0x60, 0xd4, 0xe0, 0x0c, 0xe2, 0x84, 0x8a, 0x78, 0xa6, 0x08, 0x49, 0x73, 0x71, 0x66, 0x16, 0x17,
-	0x97, 0xa6, 0xa6, 0xc4, 0x27, 0x96, 0x48, 0x30, 0x29, 0x30, 0x6a, 0x30, 0x07, 0x71, 0x40, 0x04,
-	0x1c, 0x4b, 0x84, 0xe4, 0xb8, 0xb8, 0x52, 0x2b, 0x0a, 0x32, 0x8b, 0x12, 0x4b, 0x32, 0xf3, 0xf3,
-	0x24, 0x98, 0xc1, 0xb2, 0x48, 0x22, 0x42, 0x32, 0x5c, 0x9c, 0x05, 0x45, 0x99, 0x79, 0xc9, 0x99,
-	0x05, 0x89, 0x39, 0x12, 0x2c, 0x10, 0xa3, 0xe1, 0x02, 0x49, 0x6c, 0x60, 0x87, 0x19, 0x03, 0x02,
-	0x00, 0x00, 0xff, 0xff, 0x9e, 0xc4, 0xb0, 0x49, 0xa7, 0x00, 0x00, 0x00,
+	// 373 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x54, 0x92, 0xcd, 0x6a, 0xdc, 0x30,
+	0x10, 0xc7, 0xf1, 0x6e, 0xe2, 0x58, 0xe3, 0x2d, 0x94, 0xa1, 0x2d, 0x22, 0xfd, 0xc8, 0x12, 0x7a,
+	0xd8, 0x93, 0x0f, 0xed, 0xa1, 0x1f, 0xb7, 0x36, 0xe4, 0x10, 0x7a, 0xd3, 0x0b, 0x18, 0xc5, 0x9a,
+	0x4d, 0xc4, 0x2a, 0x92, 0x90, 0xe4, 0x50, 0xbf, 0x63, 0x8f, 0x7d, 0xa0, 0x62, 0x59, 0x59, 0xd2,
+	0xdb, 0xfc, 0x7f, 0x23, 0xc6, 0x33, 0x3f, 0x0c, 0x6d, 0x9a, 0x3c, 0xc5, 0xce, 0x07, 0x97, 0x1c,
+	0x36, 0xda, 0x26, 0x0a, 0x56, 0x9a, 0xcb, 0x3f, 0x2b, 0x60, 0x57, 0xf7, 0xd2, 0x18, 0xb2, 0x77,
+	0x84, 0xef, 0x01, 0x22, 0xc5, 0xa8, 0x9d, 0xed, 0xb5, 0xe2, 0xd5, 0xb6, 0xda, 0x31, 0xc1, 0x0a,
+	0xb9, 0x51, 0xf8, 0x16, 0x98, 0x8e, 0x71, 0x24, 0xd5, 0xcb, 0xc4, 0x57, 0xdb, 0x6a, 0xb7, 0x16,
+	0xcd, 0x02, 0x7e, 0x24, 0xfc, 0x00, 0x40, 0xbf, 0xbd, 0x0e, 0x32, 0x69, 0x67, 0xf9, 0x3a, 0x77,
+	0x9f, 0x11, 0x7c, 0x07, 0xcc, 0x07, 0x6d, 0x07, 0xed, 0xa5, 0xe1, 0x27, 0xcb, 0xe8, 0x23, 0xc0,
+	0x37, 0x50, 0xe7, 0x49, 0x81, 0x9f, 0xe6, 0x56, 0x49, 0x78, 0x0e, 0x8d, 0x1c, 0x95, 0x26, 0x3b,
+	0x10, 0xaf, 0x73, 0xe7, 0x98, 0xe7, 0x6d, 0xad, 0x4b, 0xfd, 0x2d, 0xed, 0x5d, 0x20, 0x7e, 0x96,
+	0xbf, 0xc8, 0xac, 0x4b, 0x3f, 0x33, 0xc0, 0x2f, 0x50, 0x0f, 0x46, 0xea, 0x87, 0xc8, 0x9b, 0xed,
+	0x7a, 0xd7, 0x7e, 0xba, 0xe8, 0x9e, 0xae, 0xee, 0x8e, 0x17, 0x77, 0x57, 0xf9, 0xc5, 0xb5, 0x4d,
+	0x61, 0x12, 0xe5, 0xf9, 0xf9, 0x37, 0x68, 0x9f, 0x61, 0x7c, 0x09, 0xeb, 0x03, 0x4d, 0xc5, 0xc6,
+	0x5c, 0xe2, 0x2b, 0x38, 0x7d, 0x94, 0x66, 0xa4, 0xec, 0x80, 0x89, 0x25, 0x7c, 0x5f, 0x7d, 0xad,
+	0x2e, 0xff, 0x56, 0xd0, 0x5c, 0xdb, 0x47, 0x32, 0xce, 0x13, 0x72, 0x38, 0xf3, 0x72, 0x32, 0x4e,
+	0x2e, 0x2a, 0x37, 0xe2, 0x29, 0xe2, 0x6b, 0xa8, 0x0f, 0x34, 0xcd, 0x8e, 0xcb, 0x84, 0x03, 0x4d,
+	0x37, 0x0a, 0x3f, 0xc2, 0x0b, 0x39, 0xa6, 0x7b, 0xb2, 0x49, 0x0f, 0x32, 0xb9, 0x90, 0x2d, 0x6e,
+	0xc4, 0xff, 0x30, 0xef, 0xa3, 0xf6, 0x45, 0xe1, 0x5c, 0x22, 0xc2, 0x49, 0x94, 0x26, 0x65, 0x75,
+	0x1b, 0x91, 0xeb, 0x79, 0xc7, 0x40, 0xd2, 0x3c, 0x14, 0x6b, 0x4b, 0x98, 0x69, 0x1c, 0x75, 0x5a,
+	0x6c, 0x31, 0xb1, 0x04, 0xbc, 0x80, 0x76, 0xf4, 0x77, 0x41, 0x2a, 0xea, 0xe7, 0xc9, 0x4d, 0xee,
+	0x41, 0x41, 0xbf, 0xd4, 0xfe, 0xb6, 0xce, 0xbf, 0xcd, 0xe7, 0x7f, 0x03, 0x00, 0x45, 0x8f, 0xb1,
+	0x89, 0x45, 0x02, 0x00, 0x00,
 }
@@ -0,0 +1,155 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kdf
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var (
+	calibrationPassword = []byte("anvil-calibration-password")
+	calibrationSalt     = []byte("anvil-calibration-salt")
+)
+
+// Calibrate benchmarks the host and returns the most expensive parameters of
+// the algorithm whose derivation fits the target duration and memory ceiling
+// in bytes, zero disables the memory ceiling.
+//
+// Scrypt uses r=8, p=1 and grows N. Argon2id uses the memory ceiling (64MiB
+// without ceiling) with 1 thread and grows passes. PBKDF2 grows iterations.
+func Calibrate(alg Algorithm, target time.Duration, maxMemory uint64) (Params, error) {
+	if target <= 0 {
+		return Params{}, fmt.Errorf("kdf: Calibration target must be positive")
+	}
+
+	switch alg {
+	case Scrypt:
+		return calibrateScrypt(target, maxMemory)
+	case Argon2id:
+		return calibrateArgon2id(target, maxMemory)
+	case PBKDF2SHA256:
+		return calibratePBKDF2(target)
+	default:
+		return Params{}, fmt.Errorf("kdf: Unsupported algorithm '%s'", alg)
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// Time the derivation using the given parameters, through the same code path
+// as sealing and melding.
+func measure(p Params) (time.Duration, error) {
+	start := time.Now()
+	if _, err := p.KeyContext(context.Background(), calibrationPassword, calibrationSalt, 64, nil); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+func fitsMemory(p Params, maxMemory uint64) bool {
+	return maxMemory == 0 || p.MemoryCost() <= maxMemory
+}
+
+// Double N while the next derivation is expected to fit the target
+func calibrateScrypt(target time.Duration, maxMemory uint64) (Params, error) {
+	p := Params{Algorithm: Scrypt, LogN: 10, R: 8, P: 1}
+	if !fitsMemory(p, maxMemory) {
+		return Params{}, fmt.Errorf("kdf: Memory ceiling is too low for scrypt")
+	}
+
+	for p.LogN < 31 {
+		elapsed, err := measure(p)
+		if err != nil {
+			return Params{}, err
+		}
+
+		next := p
+		next.LogN++
+		if 2*elapsed > target || !fitsMemory(next, maxMemory) {
+			break
+		}
+		p = next
+	}
+
+	return p, nil
+}
+
+// Use the memory ceiling, halve memory while a single pass is too slow then
+// grow passes.
+func calibrateArgon2id(target time.Duration, maxMemory uint64) (Params, error) {
+	memory := uint64(DefaultArgon2idParams.Memory)
+	if maxMemory > 0 {
+		memory = maxMemory / 1024
+		if memory > 1<<32-1 {
+			memory = 1<<32 - 1
+		}
+	}
+
+	p := Params{Algorithm: Argon2id, Memory: uint32(memory), Time: 1, Threads: 1}
+	if err := p.Validate(); err != nil {
+		return Params{}, fmt.Errorf("kdf: Memory ceiling is too low for argon2id")
+	}
+
+	for {
+		elapsed, err := measure(p)
+		if err != nil {
+			return Params{}, err
+		}
+
+		// Grow passes
+		if elapsed <= target {
+			if elapsed > 0 {
+				if passes := uint32(target / elapsed); passes > 1 {
+					p.Time = passes
+				}
+			}
+			return p, nil
+		}
+
+		// Reduce memory
+		if p.Memory/2 < 8*uint32(p.Threads) {
+			return p, nil
+		}
+		p.Memory /= 2
+	}
+}
+
+// Scale iterations from a fixed sample
+func calibratePBKDF2(target time.Duration) (Params, error) {
+	const sample = 10000
+
+	elapsed, err := measure(Params{Algorithm: PBKDF2SHA256, Iterations: sample})
+	if err != nil {
+		return Params{}, err
+	}
+	if elapsed <= 0 {
+		elapsed = 1
+	}
+
+	iterations := uint64(sample) * uint64(target) / uint64(elapsed)
+	if iterations < 1 {
+		iterations = 1
+	}
+	if iterations > 1<<32-1 {
+		iterations = 1<<32 - 1
+	}
+
+	return Params{Algorithm: PBKDF2SHA256, Iterations: uint32(iterations)}, nil
+}
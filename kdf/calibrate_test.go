@@ -0,0 +1,114 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kdf_test
+
+import (
+	"testing"
+	"time"
+
+	"zntr.io/anvil/kdf"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCalibrate(t *testing.T) {
+	RegisterTestingT(t)
+
+	// Scrypt within memory ceiling
+	params, err := kdf.Calibrate(kdf.Scrypt, 50*time.Millisecond, 8<<20)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(params.Validate()).To(BeNil(), "Parameters should be valid")
+	Expect(params.Algorithm).To(Equal(kdf.Scrypt))
+	Expect(params.LogN).To(BeNumerically(">=", 10))
+	Expect(params.MemoryCost()).To(BeNumerically("<=", 8<<20), "Memory ceiling should be respected")
+
+	// Argon2id within memory ceiling
+	params, err = kdf.Calibrate(kdf.Argon2id, 50*time.Millisecond, 4<<20)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(params.Validate()).To(BeNil(), "Parameters should be valid")
+	Expect(params.Algorithm).To(Equal(kdf.Argon2id))
+	Expect(params.MemoryCost()).To(BeNumerically("<=", 4<<20), "Memory ceiling should be respected")
+
+	// PBKDF2
+	params, err = kdf.Calibrate(kdf.PBKDF2SHA256, 20*time.Millisecond, 0)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(params.Validate()).To(BeNil(), "Parameters should be valid")
+	Expect(params.Iterations).To(BeNumerically(">", 0))
+
+	// Invalid calibrations
+	_, err = kdf.Calibrate(kdf.Scrypt, 0, 0)
+	Expect(err).ToNot(BeNil(), "Error should not be nil")
+	_, err = kdf.Calibrate(kdf.Algorithm("bcrypt"), time.Second, 0)
+	Expect(err).ToNot(BeNil(), "Error should not be nil")
+	_, err = kdf.Calibrate(kdf.Scrypt, time.Second, 1024)
+	Expect(err).ToNot(BeNil(), "Error should not be nil")
+	_, err = kdf.Calibrate(kdf.Argon2id, time.Second, 1024)
+	Expect(err).ToNot(BeNil(), "Error should not be nil")
+}
+
+func TestPolicy(t *testing.T) {
+	RegisterTestingT(t)
+
+	for _, accepted := range []kdf.Params{
+		kdf.DefaultParams,
+		kdf.DefaultArgon2idParams,
+		kdf.DefaultPBKDF2Params,
+		{Algorithm: kdf.Scrypt, LogN: 15, R: 8, P: 1},
+		{Algorithm: kdf.Argon2id, Memory: 19 * 1024, Time: 2, Threads: 4},
+	} {
+		Expect(kdf.DefaultPolicy.Check(accepted)).To(BeNil(), "Parameters '%s' should be accepted", accepted)
+	}
+
+	for _, refused := range []kdf.Params{
+		{Algorithm: kdf.Scrypt, LogN: 14, R: 8, P: 1},
+		{Algorithm: kdf.Scrypt, LogN: 17, R: 4, P: 1},
+		{Algorithm: kdf.Argon2id, Memory: 8 * 1024, Time: 3, Threads: 1},
+		{Algorithm: kdf.PBKDF2SHA256, Iterations: 10000},
+		{Algorithm: kdf.Algorithm("bcrypt")},
+	} {
+		Expect(kdf.DefaultPolicy.Check(refused)).ToNot(BeNil(), "Parameters '%s' should be refused", refused)
+	}
+
+	// Algorithms not listed are refused
+	Expect(kdf.Policy{kdf.DefaultPBKDF2Params}.Check(kdf.DefaultParams)).ToNot(BeNil(), "Scrypt should be refused")
+}
+
+func TestMaxPolicy(t *testing.T) {
+	RegisterTestingT(t)
+
+	for _, accepted := range []kdf.Params{
+		kdf.DefaultParams,
+		kdf.DefaultArgon2idParams,
+		kdf.DefaultPBKDF2Params,
+		{Algorithm: kdf.Scrypt, LogN: 20, R: 8, P: 4},
+		{Algorithm: kdf.Argon2id, Memory: 1024 * 1024, Time: 10, Threads: 16},
+	} {
+		Expect(kdf.DefaultMaxPolicy.CheckMax(accepted)).To(BeNil(), "Parameters '%s' should be accepted", accepted)
+	}
+
+	for _, refused := range []kdf.Params{
+		{Algorithm: kdf.Scrypt, LogN: 31, R: 8, P: 1},
+		{Algorithm: kdf.Scrypt, LogN: 17, R: 1024, P: 1},
+		{Algorithm: kdf.Argon2id, Memory: 4 * 1024 * 1024, Time: 3, Threads: 4},
+		{Algorithm: kdf.Argon2id, Memory: 64 * 1024, Time: 3, Threads: 255},
+		{Algorithm: kdf.PBKDF2SHA256, Iterations: 1 << 31},
+		{Algorithm: kdf.Algorithm("bcrypt")},
+	} {
+		Expect(kdf.DefaultMaxPolicy.CheckMax(refused)).ToNot(BeNil(), "Parameters '%s' should be refused", refused)
+	}
+}
@@ -0,0 +1,216 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kdf
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Cancellation is checked and progress reported every checkInterval
+// iterations.
+const checkInterval = 1024
+
+// ProgressFunc receives the key derivation progress between 0 and 1
+type ProgressFunc func(progress float64)
+
+// KeyContext derives a key of keyLen bytes from the password and salt, it
+// aborts as soon as the context is done and reports progress if a callback is
+// given. Scrypt and Argon2id computations could not be interrupted, they are
+// abandoned on cancellation and complete in background, their progress is
+// only reported at start and end.
+func (p Params) KeyContext(ctx context.Context, password, salt []byte, keyLen int, progress ProgressFunc) ([]byte, error) {
+	return p.KeyContextDone(ctx, password, salt, keyLen, progress, nil)
+}
+
+// KeyContextDone derives a key as KeyContext does, done is called exactly once
+// when the derivation stops using memory and CPU. It is called after return
+// when a scrypt or Argon2id derivation is abandoned, derivation budgets must
+// be released by it.
+func (p Params) KeyContextDone(ctx context.Context, password, salt []byte, keyLen int, progress ProgressFunc, done func()) ([]byte, error) {
+	// Release on return unless handed to a background derivation
+	defer func() {
+		if done != nil {
+			done()
+		}
+	}()
+
+	// Check parameters
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	report(progress, 0)
+
+	var (
+		key []byte
+		err error
+	)
+	switch p.Algorithm {
+	case Scrypt:
+		key, err = backgroundKey(ctx, password, salt, func(password, salt []byte) ([]byte, error) {
+			return scrypt.Key(password, salt, 1<<p.LogN, p.R, p.P, keyLen)
+		}, done)
+		done = nil
+	case Argon2id:
+		key, err = backgroundKey(ctx, password, salt, func(password, salt []byte) ([]byte, error) {
+			return argon2.IDKey(password, salt, p.Time, p.Memory, p.Threads, uint32(keyLen)), nil
+		}, done)
+		done = nil
+	case PBKDF2SHA256:
+		key, err = pbkdf2Key(ctx, password, salt, int(p.Iterations), keyLen, progress)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report(progress, 1)
+	return key, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// tracker accounts for iterations, it checks the context and reports progress
+// every checkInterval iterations.
+type tracker struct {
+	ctx      context.Context
+	progress ProgressFunc
+	done     uint64
+	last     uint64
+	total    uint64
+}
+
+func (t *tracker) step(n uint64) error {
+	t.done += n
+	if t.done-t.last < checkInterval {
+		return nil
+	}
+	t.last = t.done
+
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+	report(t.progress, float64(t.done)/float64(t.total))
+
+	return nil
+}
+
+func report(progress ProgressFunc, value float64) {
+	if progress != nil {
+		progress(value)
+	}
+}
+
+// pbkdf2Key derives a key with PBKDF2-HMAC-SHA256, it checks for cancellation
+// between iterations.
+func pbkdf2Key(ctx context.Context, password, salt []byte, iter, keyLen int, progress ProgressFunc) ([]byte, error) {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	t := &tracker{ctx: ctx, total: uint64(numBlocks * iter), progress: progress}
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		// U1 = PRF(password, salt || uint32(block))
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+		out := dk[len(dk)-hashLen:]
+		copy(u, out)
+
+		// Un = PRF(password, Un-1)
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for x := range u {
+				out[x] ^= u[x]
+			}
+			if err := t.step(1); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return dk[:keyLen], nil
+}
+
+// backgroundKey runs an uninterruptible derivation in background and returns
+// on cancellation, done is called once the computation is over.
+func backgroundKey(ctx context.Context, password, salt []byte, derive func(password, salt []byte) ([]byte, error), done func()) ([]byte, error) {
+	// Inputs could be wiped by the caller once abandoned
+	password = append([]byte(nil), password...)
+	salt = append([]byte(nil), salt...)
+
+	type derivation struct {
+		key []byte
+		err error
+	}
+
+	var (
+		result    = make(chan derivation)
+		abandoned = make(chan struct{})
+	)
+	go func() {
+		key, err := derive(password, salt)
+		wipe(password)
+
+		select {
+		case result <- derivation{key: key, err: err}:
+		case <-abandoned:
+			wipe(key)
+			if done != nil {
+				done()
+			}
+		}
+	}()
+
+	select {
+	case r := <-result:
+		if done != nil {
+			done()
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("kdf: Unable to derive key, %v", r.err)
+		}
+		return r.key, nil
+	case <-ctx.Done():
+		close(abandoned)
+		return nil, ctx.Err()
+	}
+}
+
+// wipe zeroes the buffer
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,120 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kdf_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"zntr.io/anvil/kdf"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParamsKeyContext(t *testing.T) {
+	RegisterTestingT(t)
+
+	for _, params := range []kdf.Params{
+		{Algorithm: kdf.Scrypt, LogN: 4, R: 1, P: 1},
+		{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 2},
+		{Algorithm: kdf.Scrypt, LogN: 12, R: 3, P: 1},
+		{Algorithm: kdf.Argon2id, Memory: 1024, Time: 1, Threads: 1},
+		{Algorithm: kdf.PBKDF2SHA256, Iterations: 1},
+		{Algorithm: kdf.PBKDF2SHA256, Iterations: 4096},
+	} {
+		expected, err := params.Key([]byte("password"), []byte("saltsalt"), 64)
+		Expect(err).To(BeNil(), "Error should be nil")
+
+		var reports []float64
+		key, err := params.KeyContext(context.Background(), []byte("password"), []byte("saltsalt"), 64, func(progress float64) {
+			reports = append(reports, progress)
+		})
+		Expect(err).To(BeNil(), "Error should be nil")
+		Expect(key).To(Equal(expected), "Key should match for '%s'", params)
+
+		// Progress is monotonic from 0 to 1
+		Expect(reports[0]).To(Equal(0.0), "First report should be 0")
+		Expect(reports[len(reports)-1]).To(Equal(1.0), "Last report should be 1")
+		for i := 1; i < len(reports); i++ {
+			Expect(reports[i]).To(BeNumerically(">=", reports[i-1]), "Progress should be monotonic")
+		}
+	}
+
+	// Invalid parameters
+	_, err := kdf.Params{Algorithm: kdf.Scrypt}.KeyContext(context.Background(), []byte("password"), []byte("salt"), 64, nil)
+	Expect(err).ToNot(BeNil(), "Error should not be nil")
+}
+
+func TestParamsKeyContextCancel(t *testing.T) {
+	RegisterTestingT(t)
+
+	for _, params := range []kdf.Params{
+		{Algorithm: kdf.Scrypt, LogN: 16, R: 8, P: 1},
+		{Algorithm: kdf.PBKDF2SHA256, Iterations: 1 << 30},
+		{Algorithm: kdf.Argon2id, Memory: 64 * 1024, Time: 10, Threads: 1},
+	} {
+		// Already cancelled
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := params.KeyContext(ctx, []byte("password"), []byte("saltsalt"), 64, nil)
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue(), "Error should be context canceled")
+
+		// Cancelled while deriving
+		ctx, cancel = context.WithCancel(context.Background())
+		_, err = params.KeyContext(ctx, []byte("password"), []byte("saltsalt"), 64, func(progress float64) {
+			cancel()
+		})
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue(), "Error should be context canceled for '%s'", params)
+	}
+}
+
+func TestParamsKeyContextDone(t *testing.T) {
+	RegisterTestingT(t)
+
+	for _, params := range []kdf.Params{
+		{Algorithm: kdf.Scrypt, LogN: 4, R: 1, P: 1},
+		{Algorithm: kdf.Argon2id, Memory: 1024, Time: 1, Threads: 1},
+		{Algorithm: kdf.PBKDF2SHA256, Iterations: 1},
+		{Algorithm: kdf.Scrypt},
+	} {
+		var calls int32
+		_, _ = params.KeyContextDone(context.Background(), []byte("password"), []byte("saltsalt"), 64, nil, func() {
+			atomic.AddInt32(&calls, 1)
+		})
+		Expect(atomic.LoadInt32(&calls)).To(Equal(int32(1)), "Done should be called once on return for '%s'", params)
+	}
+
+	// Abandoned background derivations
+	for _, params := range []kdf.Params{
+		{Algorithm: kdf.Scrypt, LogN: 15, R: 8, P: 2},
+		{Algorithm: kdf.Argon2id, Memory: 64 * 1024, Time: 10, Threads: 1},
+	} {
+		var calls int32
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err := params.KeyContextDone(ctx, []byte("password"), []byte("saltsalt"), 64, func(progress float64) {
+			cancel()
+		}, func() {
+			atomic.AddInt32(&calls, 1)
+		})
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue(), "Error should be context canceled")
+		Expect(atomic.LoadInt32(&calls)).To(Equal(int32(0)), "Done should wait for the background derivation of '%s'", params)
+		Eventually(func() int32 { return atomic.LoadInt32(&calls) }, "10s").Should(Equal(int32(1)), "Done should be called once the derivation of '%s' is over", params)
+	}
+}
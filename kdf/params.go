@@ -0,0 +1,240 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kdf
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Algorithm identifies a password key derivation function
+type Algorithm string
+
+const (
+	// Scrypt uses scrypt as key derivation function
+	Scrypt Algorithm = "scrypt"
+	// Argon2id uses Argon2id as key derivation function
+	Argon2id Algorithm = "argon2id"
+	// PBKDF2SHA256 uses PBKDF2-HMAC-SHA256 as key derivation function
+	PBKDF2SHA256 Algorithm = "pbkdf2-sha256"
+)
+
+// Params defines password key derivation parameters
+type Params struct {
+	Algorithm Algorithm
+
+	// Scrypt parameters
+	LogN uint8 // CPU/Memory cost as log2(N)
+	R    int   // Block size
+	P    int   // Parallelization
+
+	// Argon2id parameters
+	Memory  uint32 // Memory cost in KiB
+	Time    uint32 // Number of passes
+	Threads uint8  // Degree of parallelism
+
+	// PBKDF2 parameters
+	Iterations uint32 // Number of iterations
+}
+
+// DefaultParams defines the default key derivation parameters (scrypt N=2^17, r=8, p=1)
+var DefaultParams = Params{
+	Algorithm: Scrypt,
+	LogN:      17,
+	R:         8,
+	P:         1,
+}
+
+// DefaultArgon2idParams defines the recommended Argon2id parameters (m=64MiB, t=3, p=4)
+var DefaultArgon2idParams = Params{
+	Algorithm: Argon2id,
+	Memory:    64 * 1024,
+	Time:      3,
+	Threads:   4,
+}
+
+// DefaultPBKDF2Params defines the recommended PBKDF2-HMAC-SHA256 parameters (i=600000)
+var DefaultPBKDF2Params = Params{
+	Algorithm:  PBKDF2SHA256,
+	Iterations: 600000,
+}
+
+// Validate the parameters
+func (p Params) Validate() error {
+	switch p.Algorithm {
+	case Scrypt:
+		if p.LogN < 1 || p.LogN > 31 {
+			return fmt.Errorf("kdf: Invalid scrypt cost, log2(N) must be between 1 and 31")
+		}
+		if p.R < 1 || p.P < 1 || uint64(p.R)*uint64(p.P) >= 1<<30 {
+			return fmt.Errorf("kdf: Invalid scrypt parameters, r and p must be positive and r*p < 2^30")
+		}
+	case Argon2id:
+		if p.Time < 1 || p.Threads < 1 {
+			return fmt.Errorf("kdf: Invalid argon2id parameters, t and p must be positive")
+		}
+		if p.Memory < 8*uint32(p.Threads) {
+			return fmt.Errorf("kdf: Invalid argon2id memory cost, m must be at least 8*p KiB")
+		}
+	case PBKDF2SHA256:
+		if p.Iterations < 1 {
+			return fmt.Errorf("kdf: Invalid pbkdf2 parameters, i must be positive")
+		}
+	default:
+		return fmt.Errorf("kdf: Unsupported algorithm '%s'", p.Algorithm)
+	}
+
+	return nil
+}
+
+// Key derives a key of keyLen bytes from the password and salt
+func (p Params) Key(password, salt []byte, keyLen int) ([]byte, error) {
+	// Check parameters
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch p.Algorithm {
+	case Scrypt:
+		key, err := scrypt.Key(password, salt, 1<<p.LogN, p.R, p.P, keyLen)
+		if err != nil {
+			return nil, fmt.Errorf("kdf: Unable to derive key, scrypt error: %v", err)
+		}
+		return key, nil
+	case Argon2id:
+		return argon2.IDKey(password, salt, p.Time, p.Memory, p.Threads, uint32(keyLen)), nil
+	case PBKDF2SHA256:
+		return pbkdf2.Key(password, salt, int(p.Iterations), keyLen, sha256.New), nil
+	default:
+		return nil, fmt.Errorf("kdf: Unsupported algorithm '%s'", p.Algorithm)
+	}
+}
+
+// MemoryCost estimates the memory required by a derivation in bytes
+func (p Params) MemoryCost() uint64 {
+	switch p.Algorithm {
+	case Scrypt:
+		// V (128*r*N) + XY (256*r) + B (128*r*p)
+		r := uint64(p.R)
+		return 128*r*(uint64(1)<<p.LogN) + 256*r + 128*r*uint64(p.P)
+	case Argon2id:
+		return uint64(p.Memory) * 1024
+	default:
+		return 0
+	}
+}
+
+// String encodes parameters as `<algorithm>$<name>=<value>,...`
+func (p Params) String() string {
+	switch p.Algorithm {
+	case Scrypt:
+		return fmt.Sprintf("%s$ln=%d,r=%d,p=%d", p.Algorithm, p.LogN, p.R, p.P)
+	case Argon2id:
+		return fmt.Sprintf("%s$m=%d,t=%d,p=%d", p.Algorithm, p.Memory, p.Time, p.Threads)
+	case PBKDF2SHA256:
+		return fmt.Sprintf("%s$i=%d", p.Algorithm, p.Iterations)
+	default:
+		return string(p.Algorithm)
+	}
+}
+
+// Parse decodes parameters from their string representation
+func Parse(value string) (Params, error) {
+	parts := strings.SplitN(value, "$", 2)
+	if len(parts) != 2 {
+		return Params{}, fmt.Errorf("kdf: Invalid parameters encoding")
+	}
+
+	// Decode name/value pairs
+	values := map[string]uint64{}
+	for _, pair := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return Params{}, fmt.Errorf("kdf: Invalid parameter '%s'", pair)
+		}
+		if _, ok := values[kv[0]]; ok {
+			return Params{}, fmt.Errorf("kdf: Duplicate parameter '%s'", kv[0])
+		}
+		v, err := strconv.ParseUint(kv[1], 10, 32)
+		if err != nil {
+			return Params{}, fmt.Errorf("kdf: Invalid parameter '%s' value, %v", kv[0], err)
+		}
+		values[kv[0]] = v
+	}
+
+	var p Params
+	switch Algorithm(parts[0]) {
+	case Scrypt:
+		if !hasOnly(values, "ln", "r", "p") || values["ln"] > 255 {
+			return Params{}, fmt.Errorf("kdf: Invalid scrypt parameters")
+		}
+		p = Params{
+			Algorithm: Scrypt,
+			LogN:      uint8(values["ln"]),
+			R:         int(values["r"]),
+			P:         int(values["p"]),
+		}
+	case Argon2id:
+		if !hasOnly(values, "m", "t", "p") || values["p"] > 255 {
+			return Params{}, fmt.Errorf("kdf: Invalid argon2id parameters")
+		}
+		p = Params{
+			Algorithm: Argon2id,
+			Memory:    uint32(values["m"]),
+			Time:      uint32(values["t"]),
+			Threads:   uint8(values["p"]),
+		}
+	case PBKDF2SHA256:
+		if !hasOnly(values, "i") {
+			return Params{}, fmt.Errorf("kdf: Invalid pbkdf2 parameters")
+		}
+		p = Params{
+			Algorithm:  PBKDF2SHA256,
+			Iterations: uint32(values["i"]),
+		}
+	default:
+		return Params{}, fmt.Errorf("kdf: Unsupported algorithm '%s'", parts[0])
+	}
+
+	// Check parameters
+	if err := p.Validate(); err != nil {
+		return Params{}, err
+	}
+
+	return p, nil
+}
+
+// -----------------------------------------------------------------------------
+
+func hasOnly(values map[string]uint64, names ...string) bool {
+	if len(values) != len(names) {
+		return false
+	}
+	for _, name := range names {
+		if _, ok := values[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kdf_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"zntr.io/anvil/kdf"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParamsEncoding(t *testing.T) {
+	RegisterTestingT(t)
+
+	Expect(kdf.DefaultParams.String()).To(Equal("scrypt$ln=17,r=8,p=1"))
+
+	params, err := kdf.Parse("scrypt$ln=12,r=16,p=2")
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(params).To(Equal(kdf.Params{Algorithm: kdf.Scrypt, LogN: 12, R: 16, P: 2}))
+	Expect(params.String()).To(Equal("scrypt$ln=12,r=16,p=2"))
+
+	Expect(kdf.DefaultArgon2idParams.String()).To(Equal("argon2id$m=65536,t=3,p=4"))
+
+	params, err = kdf.Parse("argon2id$m=19456,t=2,p=1")
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(params).To(Equal(kdf.Params{Algorithm: kdf.Argon2id, Memory: 19456, Time: 2, Threads: 1}))
+	Expect(params.String()).To(Equal("argon2id$m=19456,t=2,p=1"))
+
+	Expect(kdf.DefaultPBKDF2Params.String()).To(Equal("pbkdf2-sha256$i=600000"))
+
+	params, err = kdf.Parse("pbkdf2-sha256$i=310000")
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(params).To(Equal(kdf.Params{Algorithm: kdf.PBKDF2SHA256, Iterations: 310000}))
+	Expect(params.String()).To(Equal("pbkdf2-sha256$i=310000"))
+
+	for _, invalid := range []string{
+		"",
+		"scrypt",
+		"scrypt$ln=17,r=8",
+		"scrypt$ln=17,r=8,p=1,x=1",
+		"scrypt$ln=17,r=8,r=1",
+		"scrypt$ln=0,r=8,p=1",
+		"scrypt$ln=17,r=8,p=-1",
+		"bcrypt$ln=17,r=8,p=1",
+		"argon2id$ln=17,r=8,p=1",
+		"argon2id$m=65536,t=0,p=4",
+		"argon2id$m=16,t=3,p=4",
+		"argon2id$m=65536,t=3,p=256",
+		"pbkdf2-sha256$i=0",
+		"pbkdf2-sha256$i=1000,p=1",
+		"pbkdf2$i=1000",
+	} {
+		_, err := kdf.Parse(invalid)
+		Expect(err).ToNot(BeNil(), "Error should not be nil for '%s'", invalid)
+	}
+}
+
+func TestParamsKey(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+
+	k1, err := params.Key([]byte("password"), []byte("salt"), 64)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(k1).To(HaveLen(64))
+
+	k2, err := params.Key([]byte("password"), []byte("salt"), 64)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(k2).To(Equal(k1), "Derivation should be deterministic")
+
+	params.R = 4
+	k3, err := params.Key([]byte("password"), []byte("salt"), 64)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(k3).ToNot(Equal(k1), "Parameters should change the key")
+
+	params = kdf.Params{Algorithm: kdf.Argon2id, Memory: 1024, Time: 1, Threads: 1}
+	k4, err := params.Key([]byte("password"), []byte("saltsalt"), 64)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(k4).To(HaveLen(64))
+	Expect(k4).ToNot(Equal(k1), "Algorithm should change the key")
+}
+
+func TestParamsKeyPBKDF2(t *testing.T) {
+	RegisterTestingT(t)
+
+	// PBKDF2-HMAC-SHA256 test vectors
+	for _, vector := range []struct {
+		iterations uint32
+		expected   string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	} {
+		params := kdf.Params{Algorithm: kdf.PBKDF2SHA256, Iterations: vector.iterations}
+		key, err := params.Key([]byte("password"), []byte("salt"), 32)
+		Expect(err).To(BeNil(), "Error should be nil")
+		Expect(hex.EncodeToString(key)).To(Equal(vector.expected), "Key should match for %d iterations", vector.iterations)
+	}
+}
+
+func TestParamsMemoryCost(t *testing.T) {
+	RegisterTestingT(t)
+
+	Expect(kdf.DefaultParams.MemoryCost()).To(BeNumerically("~", 128<<20, 4096), "Default scrypt should use about 128MiB")
+	Expect(kdf.DefaultArgon2idParams.MemoryCost()).To(Equal(uint64(64<<20)), "Default argon2id should use 64MiB")
+	Expect(kdf.DefaultPBKDF2Params.MemoryCost()).To(Equal(uint64(0)), "PBKDF2 memory should be negligible")
+}
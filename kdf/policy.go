@@ -0,0 +1,111 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kdf
+
+import (
+	"fmt"
+)
+
+// Policy defines accepted algorithms with their cost bounds, algorithms not
+// listed are refused. Bounds are minimums for Check and maximums for CheckMax.
+type Policy []Params
+
+// DefaultPolicy accepts scrypt (N=2^15, r=8, p=1), Argon2id (m=19MiB, t=2,
+// p=1) and PBKDF2-HMAC-SHA256 (i=600000) as minimum costs.
+var DefaultPolicy = Policy{
+	{Algorithm: Scrypt, LogN: 15, R: 8, P: 1},
+	{Algorithm: Argon2id, Memory: 19 * 1024, Time: 2, Threads: 1},
+	{Algorithm: PBKDF2SHA256, Iterations: 600000},
+}
+
+// DefaultMaxPolicy accepts scrypt (N=2^20, r=8, p=4), Argon2id (m=1GiB, t=10,
+// p=16) and PBKDF2-HMAC-SHA256 (i=10000000) as maximum costs.
+var DefaultMaxPolicy = Policy{
+	{Algorithm: Scrypt, LogN: 20, R: 8, P: 4},
+	{Algorithm: Argon2id, Memory: 1024 * 1024, Time: 10, Threads: 16},
+	{Algorithm: PBKDF2SHA256, Iterations: 10000000},
+}
+
+// Check the parameters against the policy
+func (pol Policy) Check(p Params) error {
+	for _, min := range pol {
+		if min.Algorithm != p.Algorithm {
+			continue
+		}
+		if !p.AtLeast(min) {
+			return fmt.Errorf("kdf: Parameters '%s' are below the minimum '%s'", p, min)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("kdf: Algorithm '%s' is not accepted by policy", p.Algorithm)
+}
+
+// CheckMax checks the parameters against the policy maximums
+func (pol Policy) CheckMax(p Params) error {
+	for _, max := range pol {
+		if max.Algorithm != p.Algorithm {
+			continue
+		}
+		if !p.AtMost(max) {
+			return fmt.Errorf("kdf: Parameters '%s' are above the maximum '%s'", p, max)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("kdf: Algorithm '%s' is not accepted by policy", p.Algorithm)
+}
+
+// AtLeast reports whether the parameters use the same algorithm with costs
+// greater or equal to the minimum ones.
+func (p Params) AtLeast(min Params) bool {
+	if p.Algorithm != min.Algorithm {
+		return false
+	}
+
+	switch p.Algorithm {
+	case Scrypt:
+		return p.LogN >= min.LogN && p.R >= min.R && p.P >= min.P
+	case Argon2id:
+		// Parallelism does not change the total work
+		return p.Memory >= min.Memory && p.Time >= min.Time
+	case PBKDF2SHA256:
+		return p.Iterations >= min.Iterations
+	default:
+		return false
+	}
+}
+
+// AtMost reports whether the parameters use the same algorithm with costs
+// lower or equal to the maximum ones.
+func (p Params) AtMost(max Params) bool {
+	if p.Algorithm != max.Algorithm {
+		return false
+	}
+
+	switch p.Algorithm {
+	case Scrypt:
+		return p.LogN <= max.LogN && p.R <= max.R && p.P <= max.P
+	case Argon2id:
+		return p.Memory <= max.Memory && p.Time <= max.Time && p.Threads <= max.Threads
+	case PBKDF2SHA256:
+		return p.Iterations <= max.Iterations
+	default:
+		return false
+	}
+}
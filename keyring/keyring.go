@@ -0,0 +1,253 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Algorithm identifies an AEAD construction
+type Algorithm string
+
+const (
+	// XChaCha20Poly1305 uses XChaCha20-Poly1305 with 192bit random nonces
+	XChaCha20Poly1305 Algorithm = "XC20P"
+	// AES256GCM uses AES-256-GCM with 96bit random nonces
+	AES256GCM Algorithm = "A256GCM"
+)
+
+var (
+	// ErrNoActiveKey raised when trying to encrypt without active key
+	ErrNoActiveKey = errors.New("keyring: No active key")
+	// ErrUnknownKey raised when the ciphertext key is not usable for decryption
+	ErrUnknownKey = errors.New("keyring: Unknown or expired key")
+	// ErrInvalidCiphertext raised when the ciphertext could not be decrypted
+	ErrInvalidCiphertext = errors.New("keyring: Invalid ciphertext")
+)
+
+type key struct {
+	alg       Algorithm
+	aead      cipher.AEAD
+	retiredAt time.Time
+}
+
+// Keyring encrypts with the active key and decrypts with any key, retired keys
+// remain usable for decryption during the grace period.
+//
+// Ciphertext layout: len(keyID) (1 byte) || keyID || nonce || sealed payload,
+// the header is authenticated as additional data.
+type Keyring struct {
+	mu          sync.RWMutex
+	gracePeriod time.Duration
+	clock       ClockFunc
+	active      string
+	keys        map[string]*key
+}
+
+// New returns an empty keyring
+func New(gracePeriod time.Duration, opts ...Option) *Keyring {
+	// Default settings
+	dopts := Options{
+		Clock: DefaultClock,
+	}
+
+	// Apply Options
+	for _, o := range opts {
+		o(&dopts)
+	}
+
+	return &Keyring{
+		gracePeriod: gracePeriod,
+		clock:       dopts.Clock,
+		keys:        map[string]*key{},
+	}
+}
+
+// NewXChaCha20Poly1305 returns a keyring with the given XChaCha20-Poly1305 key
+// as active, retired keys remain usable during the grace period.
+func NewXChaCha20Poly1305(keyID string, secret []byte, gracePeriod time.Duration, opts ...Option) (*Keyring, error) {
+	kr := New(gracePeriod, opts...)
+	if err := kr.Rotate(keyID, XChaCha20Poly1305, secret); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// NewAES256GCM returns a keyring with the given AES-256-GCM key as active,
+// retired keys remain usable during the grace period.
+func NewAES256GCM(keyID string, secret []byte, gracePeriod time.Duration, opts ...Option) (*Keyring, error) {
+	kr := New(gracePeriod, opts...)
+	if err := kr.Rotate(keyID, AES256GCM, secret); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// Rotate adds the given key as active, previous active key is retired.
+func (kr *Keyring) Rotate(keyID string, alg Algorithm, secret []byte) error {
+	// Check key identifier
+	if keyID == "" || len(keyID) > 255 {
+		return fmt.Errorf("keyring: Key identifier length must be between 1 and 255")
+	}
+
+	// Build AEAD
+	aead, err := newAEAD(alg, secret)
+	if err != nil {
+		return err
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if _, ok := kr.keys[keyID]; ok {
+		return fmt.Errorf("keyring: Key '%s' already exists", keyID)
+	}
+
+	// Retire active key
+	if k, ok := kr.keys[kr.active]; ok {
+		k.retiredAt = kr.clock()
+	}
+
+	kr.keys[keyID] = &key{
+		alg:  alg,
+		aead: aead,
+	}
+	kr.active = keyID
+
+	return nil
+}
+
+// Algorithms returns the distinct algorithms of keys usable for decryption
+func (kr *Keyring) Algorithms() []Algorithm {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	var (
+		out  []Algorithm
+		seen = map[Algorithm]bool{}
+	)
+	for _, k := range kr.keys {
+		if !kr.usable(k) || seen[k.alg] {
+			continue
+		}
+		seen[k.alg] = true
+		out = append(out, k.alg)
+	}
+
+	return out
+}
+
+// Encrypt the payload using the active key
+func (kr *Keyring) Encrypt(payload []byte) ([]byte, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	k, ok := kr.keys[kr.active]
+	if !ok {
+		return nil, ErrNoActiveKey
+	}
+
+	// Prepare header
+	header := make([]byte, 0, 1+len(kr.active))
+	header = append(header, byte(len(kr.active)))
+	header = append(header, kr.active...)
+
+	// Generate nonce
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("keyring: Unable to generate nonce, %v", err)
+	}
+
+	// Seal payload
+	out := make([]byte, 0, len(header)+len(nonce)+len(payload)+k.aead.Overhead())
+	out = append(out, header...)
+	out = append(out, nonce...)
+	return k.aead.Seal(out, nonce, payload, header), nil
+}
+
+// Decrypt the ciphertext using the key referenced in its header
+func (kr *Keyring) Decrypt(ciphertext []byte) ([]byte, error) {
+	// Read header
+	if len(ciphertext) < 1 || len(ciphertext) < 1+int(ciphertext[0]) {
+		return nil, ErrInvalidCiphertext
+	}
+	header := ciphertext[:1+int(ciphertext[0])]
+	keyID := string(header[1:])
+
+	// Retired key must be in grace period, retirement is set by Rotate
+	kr.mu.RLock()
+	k, ok := kr.keys[keyID]
+	ok = ok && kr.usable(k)
+	kr.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	// Split nonce and sealed payload
+	body := ciphertext[len(header):]
+	if len(body) < k.aead.NonceSize()+k.aead.Overhead() {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce, sealed := body[:k.aead.NonceSize()], body[k.aead.NonceSize():]
+
+	// Open payload
+	payload, err := k.aead.Open(nil, nonce, sealed, header)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return payload, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// Retired keys are usable during the grace period, the lock must be held
+func (kr *Keyring) usable(k *key) bool {
+	return k.retiredAt.IsZero() || !kr.clock().After(k.retiredAt.Add(kr.gracePeriod))
+}
+
+func newAEAD(alg Algorithm, secret []byte) (cipher.AEAD, error) {
+	switch alg {
+	case XChaCha20Poly1305:
+		if len(secret) != chacha20poly1305.KeySize {
+			return nil, fmt.Errorf("keyring: XChaCha20-Poly1305 key must be %d bytes", chacha20poly1305.KeySize)
+		}
+		return chacha20poly1305.NewX(secret)
+	case AES256GCM:
+		if len(secret) != 32 {
+			return nil, fmt.Errorf("keyring: AES-256-GCM key must be 32 bytes")
+		}
+		block, err := aes.NewCipher(secret)
+		if err != nil {
+			return nil, fmt.Errorf("keyring: Unable to initialize AES cipher, %v", err)
+		}
+		return cipher.NewGCM(block)
+	default:
+		return nil, fmt.Errorf("keyring: Unsupported algorithm '%s'", alg)
+	}
+}
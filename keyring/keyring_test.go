@@ -0,0 +1,189 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keyring_test
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"zntr.io/anvil/keyring"
+
+	. "github.com/onsi/gomega"
+)
+
+func randomKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func TestKeyringRoundTrip(t *testing.T) {
+	RegisterTestingT(t)
+
+	for _, alg := range []keyring.Algorithm{keyring.XChaCha20Poly1305, keyring.AES256GCM} {
+		kr := keyring.New(time.Minute)
+		err := kr.Rotate("k1", alg, randomKey())
+		Expect(err).To(BeNil(), "Error should be nil")
+
+		c1, err := kr.Encrypt([]byte("challenge"))
+		Expect(err).To(BeNil(), "Error should be nil")
+		c2, err := kr.Encrypt([]byte("challenge"))
+		Expect(err).To(BeNil(), "Error should be nil")
+		Expect(c1).ToNot(Equal(c2), "Nonces should be random")
+
+		plaintext, err := kr.Decrypt(c1)
+		Expect(err).To(BeNil(), "Error should be nil")
+		Expect(plaintext).To(Equal([]byte("challenge")))
+
+		// Tampered ciphertext
+		c1[len(c1)-1] ^= 0x01
+		_, err = kr.Decrypt(c1)
+		Expect(err).To(Equal(keyring.ErrInvalidCiphertext), "Error should be invalid ciphertext")
+
+		// Tampered key identifier
+		c2[1] = 'x'
+		_, err = kr.Decrypt(c2)
+		Expect(err).To(Equal(keyring.ErrUnknownKey), "Error should be unknown key")
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	RegisterTestingT(t)
+
+	kr := keyring.New(time.Hour)
+	Expect(kr.Rotate("k1", keyring.XChaCha20Poly1305, randomKey())).To(BeNil())
+	old, err := kr.Encrypt([]byte("challenge"))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	Expect(kr.Rotate("k2", keyring.AES256GCM, randomKey())).To(BeNil())
+	Expect(kr.Rotate("k2", keyring.AES256GCM, randomKey())).ToNot(BeNil(), "Key identifiers should be unique")
+	current, err := kr.Encrypt([]byte("challenge"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(string(current[1:3])).To(Equal("k2"), "Active key should be used")
+
+	Expect(kr.Algorithms()).To(ConsistOf(keyring.XChaCha20Poly1305, keyring.AES256GCM), "Retired key algorithm should be reported")
+
+	// Retired key in grace period
+	plaintext, err := kr.Decrypt(old)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(plaintext).To(Equal([]byte("challenge")))
+
+	// Retired key without grace period
+	now := time.Unix(1592000000, 0)
+	clock := keyring.WithClock(func() time.Time { return now })
+	kr = keyring.New(0, clock)
+	Expect(kr.Rotate("k1", keyring.XChaCha20Poly1305, randomKey())).To(BeNil())
+	old, err = kr.Encrypt([]byte("challenge"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(kr.Rotate("k2", keyring.XChaCha20Poly1305, randomKey())).To(BeNil())
+	now = now.Add(time.Second)
+	_, err = kr.Decrypt(old)
+	Expect(err).To(Equal(keyring.ErrUnknownKey), "Error should be unknown key")
+
+	// Expired key algorithm is not reported
+	Expect(kr.Rotate("k3", keyring.AES256GCM, randomKey())).To(BeNil())
+	now = now.Add(time.Second)
+	Expect(kr.Algorithms()).To(Equal([]keyring.Algorithm{keyring.AES256GCM}), "Only usable key algorithms should be reported")
+}
+
+func TestKeyringGracePeriod(t *testing.T) {
+	RegisterTestingT(t)
+
+	now := time.Unix(1592000000, 0)
+	clock := keyring.WithClock(func() time.Time { return now })
+
+	for _, newKeyring := range []func(string, []byte, time.Duration, ...keyring.Option) (*keyring.Keyring, error){
+		keyring.NewXChaCha20Poly1305,
+		keyring.NewAES256GCM,
+	} {
+		kr, err := newKeyring("k1", randomKey(), time.Minute, clock)
+		Expect(err).To(BeNil(), "Error should be nil")
+		old, err := kr.Encrypt([]byte("challenge"))
+		Expect(err).To(BeNil(), "Error should be nil")
+		Expect(kr.Rotate("k2", keyring.AES256GCM, randomKey())).To(BeNil())
+
+		// Retired key in grace period
+		now = now.Add(time.Minute)
+		plaintext, err := kr.Decrypt(old)
+		Expect(err).To(BeNil(), "Error should be nil")
+		Expect(plaintext).To(Equal([]byte("challenge")))
+
+		// Grace period is over
+		now = now.Add(time.Second)
+		_, err = kr.Decrypt(old)
+		Expect(err).To(Equal(keyring.ErrUnknownKey), "Error should be unknown key")
+	}
+}
+
+func TestKeyringInvalidKey(t *testing.T) {
+	RegisterTestingT(t)
+
+	_, err := keyring.NewXChaCha20Poly1305("k1", []byte("short"), 0)
+	Expect(err).ToNot(BeNil(), "Error should not be nil")
+	_, err = keyring.NewAES256GCM("", randomKey(), 0)
+	Expect(err).ToNot(BeNil(), "Error should not be nil")
+
+	_, err = keyring.New(0).Encrypt([]byte("challenge"))
+	Expect(err).To(Equal(keyring.ErrNoActiveKey), "Error should be no active key")
+}
+
+func TestKeyringConcurrentRotation(t *testing.T) {
+	RegisterTestingT(t)
+
+	kr := keyring.New(time.Minute)
+	err := kr.Rotate("k0", keyring.XChaCha20Poly1305, randomKey())
+	Expect(err).To(BeNil(), "Error should be nil")
+	ciphertext, err := kr.Encrypt([]byte("challenge"))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	var (
+		wg     sync.WaitGroup
+		failed int32
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 32; i++ {
+			if kr.Rotate(fmt.Sprintf("k%d", i), keyring.XChaCha20Poly1305, randomKey()) != nil {
+				atomic.AddInt32(&failed, 1)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 32; i++ {
+			if _, err := kr.Decrypt(ciphertext); err != nil {
+				atomic.AddInt32(&failed, 1)
+			}
+		}
+	}()
+	wg.Wait()
+
+	Expect(failed).To(Equal(int32(0)), "Rotations and decryptions should succeed")
+
+	// Retired key is still in grace period
+	plaintext, err := kr.Decrypt(ciphertext)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(plaintext).To(Equal([]byte("challenge")))
+}
@@ -0,0 +1,43 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keyring
+
+import "time"
+
+// ClockFunc is the contract for current time provider
+type ClockFunc func() time.Time
+
+// Options for keyrings
+type Options struct {
+	Clock ClockFunc
+}
+
+// Option defines keyring option function
+type Option func(*Options)
+
+// WithClock defines the time provider used for key retirement
+func WithClock(clock ClockFunc) Option {
+	return func(opts *Options) {
+		opts.Clock = clock
+	}
+}
+
+var (
+	// DefaultClock is the default time provider
+	DefaultClock = time.Now
+)
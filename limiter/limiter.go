@@ -0,0 +1,187 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrExceedsBudget raised when a single derivation cost exceeds the memory budget
+var ErrExceedsBudget = errors.New("limiter: Derivation cost exceeds the memory budget")
+
+// Stats holds limiter metrics
+type Stats struct {
+	InFlight    int           // Running derivations
+	Waiting     int           // Queued derivations
+	MemoryInUse uint64        // Memory reserved by running derivations in bytes
+	Acquired    uint64        // Total of started derivations
+	Queued      uint64        // Total of derivations which had to wait
+	Canceled    uint64        // Total of waits aborted by their context
+	Rejected    uint64        // Total of derivations exceeding the memory budget
+	WaitTime    time.Duration // Cumulative time spent waiting
+}
+
+type waiter struct {
+	cost  uint64
+	ready chan struct{}
+}
+
+// Limiter bounds concurrent derivations by count and memory, waiting
+// derivations are started in arrival order.
+type Limiter struct {
+	mu            sync.Mutex
+	maxConcurrent int
+	memoryBudget  uint64
+	waiters       []*waiter
+	stats         Stats
+}
+
+// New returns a limiter allowing maxConcurrent derivations within the memory
+// budget in bytes, zero disables the corresponding limit.
+func New(maxConcurrent int, memoryBudget uint64) *Limiter {
+	return &Limiter{
+		maxConcurrent: maxConcurrent,
+		memoryBudget:  memoryBudget,
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// Acquire waits for a derivation slot of the given memory cost, the returned
+// function must be called to release it. Waiting is aborted when the context
+// is done.
+func (l *Limiter) Acquire(ctx context.Context, cost uint64) (func(), error) {
+	l.mu.Lock()
+
+	// Could never fit
+	if l.memoryBudget > 0 && cost > l.memoryBudget {
+		l.stats.Rejected++
+		l.mu.Unlock()
+		return nil, ErrExceedsBudget
+	}
+
+	// Start immediately when nobody is waiting
+	if len(l.waiters) == 0 && l.fits(cost) {
+		l.take(cost)
+		l.mu.Unlock()
+		return l.releaser(cost), nil
+	}
+
+	// Queue derivation
+	w := &waiter{cost: cost, ready: make(chan struct{})}
+	l.waiters = append(l.waiters, w)
+	l.stats.Queued++
+	l.stats.Waiting = len(l.waiters)
+	l.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case <-w.ready:
+		l.mu.Lock()
+		l.stats.WaitTime += time.Since(start)
+		l.mu.Unlock()
+		return l.releaser(cost), nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stats.WaitTime += time.Since(start)
+	l.stats.Canceled++
+
+	select {
+	case <-w.ready:
+		// Slot granted concurrently, give it back, the derivation never started
+		l.give(cost)
+		l.stats.Acquired--
+	default:
+		l.remove(w)
+	}
+	l.grant()
+
+	return nil, ctx.Err()
+}
+
+// Stats returns a snapshot of limiter metrics
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.stats
+}
+
+// -----------------------------------------------------------------------------
+
+func (l *Limiter) fits(cost uint64) bool {
+	if l.maxConcurrent > 0 && l.stats.InFlight >= l.maxConcurrent {
+		return false
+	}
+	if l.memoryBudget > 0 && l.stats.MemoryInUse+cost > l.memoryBudget {
+		return false
+	}
+	return true
+}
+
+func (l *Limiter) take(cost uint64) {
+	l.stats.InFlight++
+	l.stats.MemoryInUse += cost
+	l.stats.Acquired++
+}
+
+func (l *Limiter) give(cost uint64) {
+	l.stats.InFlight--
+	l.stats.MemoryInUse -= cost
+}
+
+// Start waiting derivations in arrival order
+func (l *Limiter) grant() {
+	for len(l.waiters) > 0 && l.fits(l.waiters[0].cost) {
+		w := l.waiters[0]
+		l.waiters = l.waiters[1:]
+		l.take(w.cost)
+		close(w.ready)
+	}
+	l.stats.Waiting = len(l.waiters)
+}
+
+func (l *Limiter) remove(w *waiter) {
+	for i, other := range l.waiters {
+		if other == w {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			break
+		}
+	}
+	l.stats.Waiting = len(l.waiters)
+}
+
+func (l *Limiter) releaser(cost uint64) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			l.give(cost)
+			l.grant()
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package limiter_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"zntr.io/anvil/limiter"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestLimiterConcurrency(t *testing.T) {
+	RegisterTestingT(t)
+
+	l := limiter.New(2, 0)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		running int
+		peak    int
+		errs    = make(chan error, 10)
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			release, err := l.Acquire(context.Background(), 1)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer release()
+
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		Expect(err).To(BeNil(), "Error should be nil")
+	}
+	Expect(peak).To(BeNumerically("<=", 2), "Concurrency should be limited")
+
+	stats := l.Stats()
+	Expect(stats.InFlight).To(Equal(0))
+	Expect(stats.Waiting).To(Equal(0))
+	Expect(stats.Acquired).To(Equal(uint64(10)))
+	Expect(stats.Queued).To(BeNumerically(">", 0), "Derivations should be queued")
+	Expect(stats.WaitTime).To(BeNumerically(">", 0), "Wait time should be recorded")
+}
+
+func TestLimiterBudget(t *testing.T) {
+	RegisterTestingT(t)
+
+	l := limiter.New(0, 100)
+
+	// Cost exceeding budget
+	_, err := l.Acquire(context.Background(), 101)
+	Expect(err).To(Equal(limiter.ErrExceedsBudget), "Error should be exceeds budget")
+
+	first, err := l.Acquire(context.Background(), 60)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(l.Stats().MemoryInUse).To(Equal(uint64(60)))
+
+	// Queued until memory is released
+	acquired := make(chan func(), 1)
+	acquireErr := make(chan error, 1)
+	go func() {
+		release, err := l.Acquire(context.Background(), 60)
+		acquireErr <- err
+		acquired <- release
+	}()
+	Eventually(func() int { return l.Stats().Waiting }).Should(Equal(1))
+
+	// Later small derivation waits for the queue head
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.Acquire(ctx, 10)
+	Expect(err).To(Equal(context.DeadlineExceeded), "Error should be deadline exceeded")
+
+	first()
+	first()
+	Expect(<-acquireErr).To(BeNil(), "Error should be nil")
+	second := <-acquired
+	Expect(l.Stats().MemoryInUse).To(Equal(uint64(60)))
+	second()
+
+	stats := l.Stats()
+	Expect(stats.MemoryInUse).To(Equal(uint64(0)))
+	Expect(stats.Rejected).To(Equal(uint64(1)))
+	Expect(stats.Canceled).To(Equal(uint64(1)))
+	Expect(stats.Acquired).To(Equal(uint64(2)))
+}
+
+func TestLimiterCancelHead(t *testing.T) {
+	RegisterTestingT(t)
+
+	l := limiter.New(0, 100)
+	first, err := l.Acquire(context.Background(), 50)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// Cancelled queue head must not block following waiters
+	ctx, cancel := context.WithCancel(context.Background())
+	headErr := make(chan error)
+	go func() {
+		_, err := l.Acquire(ctx, 80)
+		headErr <- err
+	}()
+	Eventually(func() int { return l.Stats().Waiting }).Should(Equal(1))
+
+	acquired := make(chan func(), 1)
+	acquireErr := make(chan error, 1)
+	go func() {
+		release, err := l.Acquire(context.Background(), 40)
+		acquireErr <- err
+		acquired <- release
+	}()
+	Eventually(func() int { return l.Stats().Waiting }).Should(Equal(2))
+
+	cancel()
+	Expect(<-headErr).To(Equal(context.Canceled), "Error should be context canceled")
+	Expect(<-acquireErr).To(BeNil(), "Error should be nil")
+	second := <-acquired
+	Expect(l.Stats().MemoryInUse).To(Equal(uint64(90)))
+
+	first()
+	second()
+}
+
+func TestLimiterCancelGranted(t *testing.T) {
+	RegisterTestingT(t)
+
+	l := limiter.New(1, 0)
+
+	// Cancellation racing with the grant must not count as acquired
+	var started uint64
+	for i := 0; i < 100; i++ {
+		holder, err := l.Acquire(context.Background(), 0)
+		Expect(err).To(BeNil(), "Error should be nil")
+		started++
+
+		ctx, cancel := context.WithCancel(context.Background())
+		waiter := make(chan func())
+		go func() {
+			release, _ := l.Acquire(ctx, 0)
+			waiter <- release
+		}()
+		Eventually(func() int { return l.Stats().Waiting }).Should(Equal(1))
+
+		cancel()
+		holder()
+		if release := <-waiter; release != nil {
+			started++
+			release()
+		}
+	}
+
+	stats := l.Stats()
+	Expect(stats.Acquired).To(Equal(started), "Only started derivations should be accounted")
+	Expect(stats.InFlight).To(Equal(0), "Slots should be released")
+}
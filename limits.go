@@ -0,0 +1,47 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package anvil
+
+import (
+	"sync"
+
+	"zntr.io/anvil/limiter"
+)
+
+var (
+	limiterMutex sync.RWMutex
+	limiterValue *limiter.Limiter
+)
+
+// SetDerivationLimiter defines the process-wide limiter used by password
+// derivations of Seal, Meld and Derive, nil removes limits.
+func SetDerivationLimiter(l *limiter.Limiter) {
+	limiterMutex.Lock()
+	defer limiterMutex.Unlock()
+
+	limiterValue = l
+}
+
+// -----------------------------------------------------------------------------
+
+func derivationLimiter() *limiter.Limiter {
+	limiterMutex.RLock()
+	defer limiterMutex.RUnlock()
+
+	return limiterValue
+}
@@ -0,0 +1,104 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package anvil_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"zntr.io/anvil"
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/limiter"
+	"zntr.io/anvil/seal"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestDerivationLimiter(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+
+	l := limiter.New(1, 4*params.MemoryCost())
+	anvil.SetDerivationLimiter(l)
+	defer anvil.SetDerivationLimiter(nil)
+
+	// Concurrent seals
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, 4)
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := anvil.Seal("toto", "foo", seal.WithKDFParams(params))
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		Expect(err).To(BeNil(), "Error should be nil")
+	}
+
+	stats := l.Stats()
+	Expect(stats.Acquired).To(Equal(uint64(4)), "All derivations should be accounted")
+	Expect(stats.InFlight).To(Equal(0), "Slots should be released")
+	Expect(stats.MemoryInUse).To(Equal(uint64(0)), "Memory should be released")
+
+	// Derivation exceeding the memory budget
+	_, err := anvil.Seal("toto", "foo", seal.WithKDFParams(kdf.Params{Algorithm: kdf.Scrypt, LogN: 14, R: 8, P: 1}))
+	Expect(errors.Is(err, limiter.ErrExceedsBudget)).To(BeTrue(), "Error should be exceeds budget")
+
+	// Context aware wait
+	release, err := l.Acquire(context.Background(), 0)
+	Expect(err).To(BeNil(), "Error should be nil")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = anvil.SealContext(ctx, "toto", "foo", seal.WithKDFParams(params))
+	Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue(), "Error should be deadline exceeded")
+	release()
+
+	Expect(l.Stats().Canceled).To(Equal(uint64(1)))
+}
+
+func TestDerivationLimiterAbandonedArgon2id(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Argon2id, Memory: 64 * 1024, Time: 10, Threads: 1}
+
+	l := limiter.New(1, params.MemoryCost())
+	anvil.SetDerivationLimiter(l)
+	defer anvil.SetDerivationLimiter(nil)
+
+	// Cancelled derivation keeps its reservation until completion
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := anvil.SealContext(ctx, "toto", "foo", seal.WithKDFParams(params), seal.WithProgress(func(progress float64) {
+		cancel()
+	}))
+	Expect(errors.Is(err, context.Canceled)).To(BeTrue(), "Error should be context canceled")
+	Expect(l.Stats().MemoryInUse).To(Equal(params.MemoryCost()), "Memory should still be reserved")
+
+	Eventually(func() uint64 { return l.Stats().MemoryInUse }, "10s").Should(Equal(uint64(0)), "Memory should be released")
+	Expect(l.Stats().InFlight).To(Equal(0), "Slot should be released")
+}
@@ -0,0 +1,162 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package meld
+
+import (
+	"time"
+
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/suite"
+)
+
+// ClockFunc is the contract for current time provider
+type ClockFunc func() time.Time
+
+// Options for challenge melding
+type Options struct {
+	OmitPublicKey bool
+	KDF           kdf.Params
+	MaxKDF        kdf.Policy
+	Salt          []byte
+	Realm         string
+	Suite         suite.Suite
+	FIPS          bool
+	Progress      kdf.ProgressFunc
+	Audience      string
+	Origin        string
+	Opaque        bool
+	Clock         ClockFunc
+	Leeway        time.Duration
+}
+
+// Option defines meld option contract option function
+type Option func(*Options)
+
+// WithoutPublicKey removes the public key from the token, the server must
+// resolve it from the principal.
+func WithoutPublicKey() Option {
+	return func(opts *Options) {
+		opts.OmitPublicKey = true
+	}
+}
+
+// WithKDFParams defines the password key derivation parameters, they must
+// match the sealed ones. Parameters carried by the challenge take precedence.
+func WithKDFParams(params kdf.Params) Option {
+	return func(opts *Options) {
+		opts.KDF = params
+	}
+}
+
+// WithMaxKDF defines the maximum key derivation costs accepted from the
+// server, challenges requiring more are rejected before deriving.
+func WithMaxKDF(policy kdf.Policy) Option {
+	return func(opts *Options) {
+		opts.MaxKDF = policy
+	}
+}
+
+// WithSalt defines the key derivation salt, it must match the sealed one. Salt
+// carried by the challenge takes precedence.
+func WithSalt(salt []byte) Option {
+	return func(opts *Options) {
+		opts.Salt = salt
+	}
+}
+
+// WithRealm defines the expected application realm bound to the key
+// derivation, challenges forged for another realm are rejected.
+func WithRealm(realm string) Option {
+	return func(opts *Options) {
+		opts.Realm = realm
+	}
+}
+
+// WithAudience defines the expected challenge audience
+func WithAudience(audience string) Option {
+	return func(opts *Options) {
+		opts.Audience = audience
+	}
+}
+
+// WithOrigin binds the origin the client is talking to in the signature, the
+// server must expect the same origin.
+func WithOrigin(origin string) Option {
+	return func(opts *Options) {
+		opts.Origin = origin
+	}
+}
+
+// WithOpaqueChallenge allows encrypted challenges which could not be
+// validated by the client, an origin binding is required.
+func WithOpaqueChallenge() Option {
+	return func(opts *Options) {
+		opts.Opaque = true
+	}
+}
+
+// WithClock defines the time provider used for challenge validation
+func WithClock(clock ClockFunc) Option {
+	return func(opts *Options) {
+		opts.Clock = clock
+	}
+}
+
+// WithLeeway defines the tolerated clock skew with the forging server,
+// DefaultLeeway is used when not set.
+func WithLeeway(leeway time.Duration) Option {
+	return func(opts *Options) {
+		opts.Leeway = leeway
+	}
+}
+
+// WithSuite defines the signature suite, it must match the sealed one. Suite
+// carried by the challenge takes precedence.
+func WithSuite(s suite.Suite) Option {
+	return func(opts *Options) {
+		opts.Suite = s
+	}
+}
+
+// WithFIPS enables the FIPS profile, it defaults to PBKDF2-HMAC-SHA256 and
+// ECDSA P-256 and refuses non-approved algorithms even when sent by the
+// server.
+func WithFIPS() Option {
+	return func(opts *Options) {
+		opts.FIPS = true
+		opts.KDF = kdf.DefaultPBKDF2Params
+		opts.Suite = suite.P256
+	}
+}
+
+// WithProgress defines the key derivation progress callback, it receives
+// values between 0 and 1.
+func WithProgress(progress kdf.ProgressFunc) Option {
+	return func(opts *Options) {
+		opts.Progress = progress
+	}
+}
+
+var (
+	// DefaultClock is the default time provider
+	DefaultClock = time.Now
+
+	// DefaultLeeway is the default tolerated clock skew with the forging
+	// server, client clocks are less reliable than server ones.
+	DefaultLeeway = 30 * time.Second
+)
@@ -17,14 +17,32 @@
 
 package anvil
 
-// Seal a public key matching the principal / password credentials
-func Seal(principal, password string) (string, error) {
-	// Derive password to generate the key pair
-	pub, _, err := derivePassword([]byte(principal), []byte(password))
+import (
+	"context"
+
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/seal"
+)
+
+// KDFParams defines password key derivation parameters
+type KDFParams = kdf.Params
+
+// Seal a verifier matching the principal / password credentials, it holds the
+// public key and the key derivation parameters.
+func Seal(principal, password string, opts ...seal.Option) (string, error) {
+	return SealContext(context.Background(), principal, password, opts...)
+}
+
+// SealContext seals a verifier matching the principal / password credentials,
+// password derivation is aborted when the context is done.
+func SealContext(ctx context.Context, principal, password string, opts ...seal.Option) (string, error) {
+	// Derive credentials
+	creds, err := DeriveContext(ctx, principal, password, opts...)
 	if err != nil {
 		return "", err
 	}
+	defer creds.Wipe()
 
-	// Encode public key to OKP
-	return toOKP(pub), nil
+	// Encode verifier
+	return creds.Seal()
 }
@@ -19,8 +19,17 @@ package anvil_test
 
 import (
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
 
 	"zntr.io/anvil"
+	"zntr.io/anvil/forge"
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/meld"
+	"zntr.io/anvil/seal"
+	"zntr.io/anvil/suite"
+	"zntr.io/anvil/tap"
 
 	. "github.com/onsi/gomega"
 )
@@ -32,5 +41,269 @@ func TestPasswordSeal(t *testing.T) {
 	Expect(err).To(BeNil(), "Error should be nil")
 	Expect(publicKey).ToNot(BeNil(), "PublicKey should not be nil")
 	Expect(publicKey).ToNot(BeEmpty(), "PublicKey should not be blank")
-	Expect(publicKey).To(Equal("qrK4RAzbzEJ5w2wuObrFjNivdaI-mMoPJhqxRfkqDt0"))
+	Expect(publicKey).To(HavePrefix("$anvil$v=1$ed25519$scrypt$ln=17,r=8,p=1$"))
+
+	// Random salt
+	verifier, err := anvil.ParseVerifier(publicKey)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifier.Salt).To(HaveLen(16), "Salt should be generated")
+
+	// Fixed salt
+	publicKey, err = anvil.Seal("toto", "foo", seal.WithSalt([]byte("0123456789abcdef")))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(publicKey).To(Equal("$anvil$v=1$ed25519$scrypt$ln=17,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$NzP0xF4ppabX0U7MOlZhjYyTeLB8u3vptGwpBHje1hw"))
+}
+
+func TestPasswordSealKDFParams(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 2}
+
+	sealed, err := anvil.Seal("toto", "foo", seal.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(sealed).To(HavePrefix("$anvil$v=1$ed25519$scrypt$ln=10,r=8,p=2$"))
+
+	verifier, err := anvil.ParseVerifier(sealed)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifier.KDF).To(Equal(params), "KDF parameters should be decoded")
+	Expect(verifier.String()).To(Equal(sealed), "Verifier encoding should be stable")
+
+	resolver := tap.WithPublicKeyResolver(func(principal string) ([]ed25519.PublicKey, error) {
+		return []ed25519.PublicKey{verifier.PublicKey}, nil
+	})
+
+	// Meld with client known parameters
+	challenge, _, err := anvil.Forge("toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge, meld.WithKDFParams(verifier.KDF), meld.WithSalt(verifier.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err := anvil.Tap(token, resolver)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result).ToNot(BeNil(), "Result should not be nil")
+
+	// Meld with parameters sent by the server
+	challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err = anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err = anvil.Tap(token, resolver)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result).ToNot(BeNil(), "Result should not be nil")
+
+	// Invalid parameters
+	_, err = anvil.Seal("toto", "foo", seal.WithKDFParams(kdf.Params{Algorithm: kdf.Scrypt}))
+	Expect(err).ToNot(BeNil(), "Error should not be nil")
+}
+
+func TestParseVerifier(t *testing.T) {
+	RegisterTestingT(t)
+
+	// Legacy public key
+	verifier, err := anvil.ParseVerifier("qrK4RAzbzEJ5w2wuObrFjNivdaI-mMoPJhqxRfkqDt0")
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifier.KDF).To(Equal(kdf.DefaultParams), "KDF parameters should be default ones")
+	Expect(verifier.Salt).To(BeNil(), "Salt should be empty")
+	Expect(verifier.String()).To(Equal("$anvil$v=1$ed25519$scrypt$ln=17,r=8,p=1$$qrK4RAzbzEJ5w2wuObrFjNivdaI-mMoPJhqxRfkqDt0"))
+
+	// Unsalted verifier
+	verifier, err = anvil.ParseVerifier("$anvil$v=1$ed25519$scrypt$ln=17,r=8,p=1$$qrK4RAzbzEJ5w2wuObrFjNivdaI-mMoPJhqxRfkqDt0")
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifier.Salt).To(BeNil(), "Salt should be empty")
+
+	// Principal is used as salt
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err := anvil.Tap(token, tap.WithPublicKeyResolver(func(principal string) ([]ed25519.PublicKey, error) {
+		return []ed25519.PublicKey{verifier.PublicKey}, nil
+	}))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result).ToNot(BeNil(), "Result should not be nil")
+
+	for _, invalid := range []string{
+		"",
+		"$anvil$v=1$ed25519$scrypt$ln=17,r=8,p=1",
+		"$anvil$v=9$ed25519$scrypt$ln=17,r=8,p=1$$qrK4RAzbzEJ5w2wuObrFjNivdaI-mMoPJhqxRfkqDt0",
+		"$anvil$v=2$scrypt$ln=17,r=8,p=1$$qrK4RAzbzEJ5w2wuObrFjNivdaI-mMoPJhqxRfkqDt0",
+		"$anvil$v=1$scrypt$ln=17,r=8,p=1$qrK4RAzbzEJ5w2wuObrFjNivdaI-mMoPJhqxRfkqDt0",
+		"$anvil$v=1$ed25519$scrypt$ln=17,r=8,p=1$!!$qrK4RAzbzEJ5w2wuObrFjNivdaI-mMoPJhqxRfkqDt0",
+		"$anvil$v=1$ed25519$bcrypt$ln=17,r=8,p=1$$qrK4RAzbzEJ5w2wuObrFjNivdaI-mMoPJhqxRfkqDt0",
+		"$anvil$v=1$ed25519$scrypt$ln=17,r=8$$qrK4RAzbzEJ5w2wuObrFjNivdaI-mMoPJhqxRfkqDt0",
+		"$anvil$v=1$ed25519$scrypt$ln=17,r=8,p=1$$qrK4RAzbzEJ5w2wuObrFjNivdaI",
+		"$anvil$v=1$scrypt$ln=17,r=8,p=1$$qrK4RAzbzEJ5w2wuObrFjNivdaI-mMoPJhqxRfkqDt0",
+		"$anvil$v=1$rsa$scrypt$ln=17,r=8,p=1$$qrK4RAzbzEJ5w2wuObrFjNivdaI-mMoPJhqxRfkqDt0",
+		"$anvil$v=1$p256$scrypt$ln=17,r=8,p=1$$qrK4RAzbzEJ5w2wuObrFjNivdaI-mMoPJhqxRfkqDt0",
+	} {
+		_, err := anvil.ParseVerifier(invalid)
+		Expect(err).ToNot(BeNil(), "Error should not be nil for '%s'", invalid)
+	}
+}
+
+func TestPasswordSealArgon2id(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Argon2id, Memory: 8 * 1024, Time: 1, Threads: 2}
+
+	sealed, err := anvil.Seal("toto", "foo", seal.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(sealed).To(HavePrefix("$anvil$v=1$ed25519$argon2id$m=8192,t=1,p=2$"))
+
+	verifier, err := anvil.ParseVerifier(sealed)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifier.KDF).To(Equal(params), "KDF parameters should be decoded")
+
+	// Scrypt and Argon2id keys must differ
+	scryptSealed, err := anvil.Seal("toto", "foo", seal.WithKDFParams(kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}))
+	Expect(err).To(BeNil(), "Error should be nil")
+	scryptVerifier, err := anvil.ParseVerifier(scryptSealed)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(scryptVerifier.PublicKey).ToNot(Equal(verifier.PublicKey), "Public keys should differ")
+
+	// Meld with parameters sent by the server
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err := anvil.Tap(token, tap.WithPublicKeyResolver(func(principal string) ([]ed25519.PublicKey, error) {
+		return []ed25519.PublicKey{verifier.PublicKey}, nil
+	}))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result).ToNot(BeNil(), "Result should not be nil")
+}
+
+func TestPasswordSealRealm(t *testing.T) {
+	RegisterTestingT(t)
+
+	salt := []byte("0123456789abcdef")
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+
+	noRealm, err := anvil.Seal("toto", "foo", seal.WithKDFParams(params), seal.WithSalt(salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	realmA, err := anvil.Seal("toto", "foo", seal.WithKDFParams(params), seal.WithSalt(salt), seal.WithRealm("a.example.com"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	realmB, err := anvil.Seal("toto", "foo", seal.WithKDFParams(params), seal.WithSalt(salt), seal.WithRealm("b.example.com"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(realmA).ToNot(Equal(noRealm), "Realm should change the key")
+	Expect(realmA).ToNot(Equal(realmB), "Realm should change the key")
+
+	verifier, err := anvil.ParseVerifier(realmA)
+	Expect(err).To(BeNil(), "Error should be nil")
+	resolver := tap.WithPublicKeyResolver(func(principal string) ([]ed25519.PublicKey, error) {
+		return []ed25519.PublicKey{verifier.PublicKey}, nil
+	})
+
+	// Realm sent by the server
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(params), forge.WithSalt(salt), forge.WithRealm("a.example.com"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge, meld.WithRealm("a.example.com"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err := anvil.Tap(token, resolver)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result).ToNot(BeNil(), "Result should not be nil")
+
+	// Challenge forged for another realm
+	challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(params), forge.WithSalt(salt), forge.WithRealm("b.example.com"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Meld("toto", "foo", challenge, meld.WithRealm("a.example.com"))
+	Expect(err).To(MatchError(anvil.ErrRealmMismatch), "Error should be realm mismatch")
+
+	// Key derived for another realm
+	token, err = anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err = anvil.Tap(token, resolver)
+	Expect(err).To(MatchError(anvil.ErrUnregisteredPublicKey), "Error should be unregistered public key")
+	Expect(result).To(BeNil(), "Result should be nil")
+}
+
+func TestPasswordSealP256(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+
+	sealed, err := anvil.Seal("toto", "foo", seal.WithKDFParams(params), seal.WithSuite(suite.P256))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(sealed).To(HavePrefix("$anvil$v=1$p256$scrypt$ln=10,r=8,p=1$"))
+
+	verifier, err := anvil.ParseVerifier(sealed)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifier.Suite).To(Equal(suite.P256), "Suite should be decoded")
+	Expect(verifier.String()).To(Equal(sealed), "Verifier encoding should be stable")
+
+	resolver := tap.WithVerifierResolver(func(principal string) ([]string, error) {
+		return []string{sealed}, nil
+	})
+
+	// Meld with parameters sent by the server
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt), forge.WithSuite(verifier.Suite))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(token).To(HavePrefix("anvil1.p256."), "Token should carry the suite")
+	result, err := anvil.Tap(token, resolver)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result).ToNot(BeNil(), "Result should not be nil")
+
+	// Public key resolved by the server
+	token, err = anvil.Meld("toto", "foo", challenge, meld.WithoutPublicKey())
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err = anvil.Tap(token, resolver)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result).ToNot(BeNil(), "Result should not be nil")
+
+	// Ed25519 key for a P-256 verifier
+	challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err = anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(token).To(HavePrefix("anvil1.ed25519."), "Token should carry the suite")
+	result, err = anvil.Tap(token, resolver)
+	Expect(err).To(MatchError(anvil.ErrUnregisteredPublicKey), "Error should be unregistered public key")
+	Expect(result).To(BeNil(), "Result should be nil")
+
+	// Ed25519 resolver only resolves Ed25519 keys
+	challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt), forge.WithSuite(verifier.Suite))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err = anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err = anvil.Tap(token, tap.WithPublicKeyResolver(func(principal string) ([]ed25519.PublicKey, error) {
+		return []ed25519.PublicKey{verifier.PublicKey}, nil
+	}))
+	Expect(err).To(MatchError(anvil.ErrUnregisteredPublicKey), "Error should be unregistered public key")
+	Expect(result).To(BeNil(), "Result should be nil")
+}
+
+func TestVerifierPolicy(t *testing.T) {
+	RegisterTestingT(t)
+
+	policy := kdf.Policy{{Algorithm: kdf.Scrypt, LogN: 11, R: 8, P: 1}}
+
+	// Calibrated parameters
+	params, err := kdf.Calibrate(kdf.Scrypt, 20*time.Millisecond, 4<<20)
+	Expect(err).To(BeNil(), "Error should be nil")
+	sealed, err := anvil.Seal("toto", "foo", seal.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+	verifier, err := anvil.ParseVerifier(sealed)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifier.KDF).To(Equal(params), "Calibrated parameters should be sealed")
+
+	// Minimum cost
+	weak, err := anvil.Seal("toto", "foo", seal.WithKDFParams(kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}))
+	Expect(err).To(BeNil(), "Error should be nil")
+	verifier, err = anvil.ParseVerifier(weak)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifier.CheckPolicy(policy)).To(MatchError(anvil.ErrWeakVerifier), "Error should be weak verifier")
+
+	strong, err := anvil.Seal("toto", "foo", seal.WithKDFParams(kdf.Params{Algorithm: kdf.Scrypt, LogN: 11, R: 8, P: 1}))
+	Expect(err).To(BeNil(), "Error should be nil")
+	verifier, err = anvil.ParseVerifier(strong)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifier.CheckPolicy(policy)).To(BeNil(), "Verifier should be accepted")
+
+	// Algorithm not accepted
+	argon, err := anvil.Seal("toto", "foo", seal.WithKDFParams(kdf.Params{Algorithm: kdf.Argon2id, Memory: 8 * 1024, Time: 1, Threads: 1}))
+	Expect(err).To(BeNil(), "Error should be nil")
+	verifier, err = anvil.ParseVerifier(argon)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifier.CheckPolicy(policy)).To(MatchError(anvil.ErrWeakVerifier), "Error should be weak verifier")
 }
@@ -0,0 +1,123 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package anvil
+
+import (
+	"context"
+	"fmt"
+
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/meld"
+	"zntr.io/anvil/suite"
+	"zntr.io/anvil/tap"
+)
+
+// Register builds a registration message for a forged challenge, it carries
+// the sealed verifier signed by its derived private key to prove possession.
+// Upgrade parameters sent by the server are used for the verifier, current
+// ones otherwise.
+func Register(principal, password, challenge string, opts ...meld.Option) (string, error) {
+	return RegisterContext(context.Background(), principal, password, challenge, opts...)
+}
+
+// RegisterContext builds a registration message, password derivation is
+// aborted when the context is done.
+func RegisterContext(ctx context.Context, principal, password, challenge string, opts ...meld.Option) (string, error) {
+	// Default settings
+	dopts := meld.Options{
+		KDF:    kdf.DefaultParams,
+		MaxKDF: kdf.DefaultMaxPolicy,
+		Suite:  suite.Default,
+		Clock:  meld.DefaultClock,
+		Leeway: meld.DefaultLeeway,
+	}
+
+	// Apply Options
+	for _, o := range opts {
+		o(&dopts)
+	}
+
+	// Decode and validate challenge
+	challengeRaw, envelope, err := openChallenge(principal, challenge, &dopts)
+	if err != nil {
+		return "", err
+	}
+
+	// Select verifier parameters
+	params, err := verifierParams(envelope, &dopts)
+	if err != nil {
+		return "", err
+	}
+
+	// Derive credentials with a fresh salt
+	creds, err := DeriveContext(ctx, principal, password, upgradeOptions(params, &dopts)...)
+	if err != nil {
+		return "", err
+	}
+	defer creds.Wipe()
+
+	// Encode verifier
+	verifier, err := creds.Seal()
+	if err != nil {
+		return "", err
+	}
+
+	// Sign registration transcript with the verifier private key
+	signatureRaw, err := creds.signer.Sign(transcript(registerLabel, principal, dopts.Origin, challengeRaw, []byte(verifier)))
+	if err != nil {
+		return "", fmt.Errorf("anvil: Unable to sign registration message, %v", err)
+	}
+
+	// Return message, the public key is always embedded
+	return formatToken(registerV1, dopts.Suite, creds.PublicKey(), challengeRaw, signatureRaw, []byte(verifier)), nil
+}
+
+// VerifyRegistration checks a registration message, the signature must be
+// produced by the private key matching the carried verifier. The result
+// Verifier must be stored only once the message is verified. An authenticator
+// verifier or a session store is required, the session store also prevents
+// replays.
+func VerifyRegistration(message string, opts ...tap.Option) (*TapResult, error) {
+	// Default settings
+	dopts := tap.Options{
+		Decryptor: tap.DefaultDecryptor,
+		Clock:     tap.DefaultClock,
+	}
+
+	// Apply Options
+	for _, o := range opts {
+		o(&dopts)
+	}
+
+	// Challenge must be proven as issued by the server
+	if dopts.AuthenticatorVerifier == nil && dopts.SessionStore == nil {
+		return nil, fmt.Errorf("%w, registration verification requires an authenticator verifier or a session store", ErrUnauthenticatedChallenge)
+	}
+
+	// Decode message
+	t, err := parseToken(message, false)
+	if err != nil {
+		return nil, err
+	}
+	if t.Version != registerV1 {
+		return nil, fmt.Errorf("%w, '%s' messages are not registration messages", ErrUnsupportedToken, t.Version)
+	}
+
+	// Verify message
+	return verifyToken(t, &dopts)
+}
@@ -0,0 +1,149 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package anvil_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"zntr.io/anvil"
+	"zntr.io/anvil/forge"
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/meld"
+	"zntr.io/anvil/session"
+	"zntr.io/anvil/tap"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRegister(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+	store := session.NewMemoryStore(time.Minute)
+
+	// Register account
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(params), forge.WithSessionStore(store))
+	Expect(err).To(BeNil(), "Error should be nil")
+	message, err := anvil.Register("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err := anvil.VerifyRegistration(message, tap.WithSessionStore(store))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result.Principal).To(Equal("toto"), "Principal should match")
+	Expect(result.Verifier).ToNot(BeEmpty(), "Verifier should be set")
+	Expect(result.Upgrade).To(BeEmpty(), "Upgrade should be empty")
+
+	verifier, err := anvil.ParseVerifier(result.Verifier)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifier.KDF).To(Equal(params), "Verifier should use forged parameters")
+
+	// Replayed registration
+	_, err = anvil.VerifyRegistration(message, tap.WithSessionStore(store))
+	Expect(err).To(MatchError(anvil.ErrConsumedChallenge), "Error should be raised")
+
+	// Registered verifier is usable
+	challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Tap(token, tap.WithVerifierResolver(func(principal string) ([]string, error) {
+		return []string{result.Verifier}, nil
+	}))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// Registration message is not a login token
+	_, err = anvil.Tap(message)
+	Expect(err).To(MatchError(anvil.ErrUnsupportedToken), "Error should be raised")
+
+	// Login token is not a registration message
+	_, err = anvil.VerifyRegistration(token, tap.WithSessionStore(store))
+	Expect(err).To(MatchError(anvil.ErrUnsupportedToken), "Error should be raised")
+
+	// Challenge origin could not be checked
+	challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+	message, err = anvil.Register("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.VerifyRegistration(message)
+	Expect(err).To(MatchError(anvil.ErrUnauthenticatedChallenge), "Error should be raised")
+}
+
+func TestRegisterCopiedKey(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+	store := session.NewMemoryStore(time.Minute)
+
+	// Victim registration
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(params), forge.WithSessionStore(store))
+	Expect(err).To(BeNil(), "Error should be nil")
+	victim, err := anvil.Register("toto", "foo", challenge, meld.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// Attacker registration
+	challenge, _, err = anvil.Forge("titi", forge.WithKDFParams(params), forge.WithSessionStore(store))
+	Expect(err).To(BeNil(), "Error should be nil")
+	attacker, err := anvil.Register("titi", "bar", challenge, meld.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	victimParts := strings.Split(victim, ".")
+	attackerParts := strings.Split(attacker, ".")
+
+	// Copied verifier only
+	forged := append([]string{}, attackerParts[:5]...)
+	forged = append(forged, victimParts[5])
+	_, err = anvil.VerifyRegistration(strings.Join(forged, "."), tap.WithSessionStore(store))
+	Expect(err).To(MatchError(anvil.ErrMalformedToken), "Error should be raised")
+
+	// Copied verifier and public key
+	forged = append([]string{}, attackerParts...)
+	forged[2], forged[5] = victimParts[2], victimParts[5]
+	_, err = anvil.VerifyRegistration(strings.Join(forged, "."), tap.WithSessionStore(store))
+	Expect(err).To(MatchError(anvil.ErrInvalidSignature), "Error should be raised")
+}
+
+func TestRegisterPolicy(t *testing.T) {
+	RegisterTestingT(t)
+
+	weak := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+	current := kdf.Params{Algorithm: kdf.Scrypt, LogN: 11, R: 8, P: 1}
+	policy := kdf.Policy{current}
+	store := session.NewMemoryStore(time.Minute)
+
+	// Client sealing below the policy
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(weak), forge.WithSessionStore(store))
+	Expect(err).To(BeNil(), "Error should be nil")
+	message, err := anvil.Register("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.VerifyRegistration(message, tap.WithKDFPolicy(policy), tap.WithSessionStore(store))
+	Expect(err).To(MatchError(anvil.ErrWeakVerifier), "Error should be raised")
+
+	// Server requested parameters
+	challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(weak), forge.WithUpgrade(current), forge.WithSessionStore(store))
+	Expect(err).To(BeNil(), "Error should be nil")
+	message, err = anvil.Register("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err := anvil.VerifyRegistration(message, tap.WithKDFPolicy(policy), tap.WithSessionStore(store))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result.NeedsUpgrade).To(BeFalse(), "Verifier should not need upgrade")
+
+	verifier, err := anvil.ParseVerifier(result.Verifier)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifier.KDF).To(Equal(current), "Verifier should use requested parameters")
+}
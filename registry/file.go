@@ -0,0 +1,153 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fileContent is the JSON document persisted by the file registry
+type fileContent struct {
+	Principals principals `json:"principals"`
+}
+
+type fileRegistry struct {
+	sync.RWMutex
+	path       string
+	principals principals
+}
+
+// NewFileRegistry returns a concurrency-safe registry persisted as a JSON
+// document, it is created on first update when missing. Updates replace the
+// file atomically, the registry must be the only writer.
+func NewFileRegistry(path string) (Registry, error) {
+	r := &fileRegistry{
+		path:       path,
+		principals: principals{},
+	}
+
+	// Load existing registry
+	raw, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return r, nil
+	case err != nil:
+		return nil, fmt.Errorf("registry: Unable to read registry file, %v", err)
+	}
+
+	var content fileContent
+	if err := json.Unmarshal(raw, &content); err != nil {
+		return nil, fmt.Errorf("registry: Unable to decode registry file, %v", err)
+	}
+	if content.Principals != nil {
+		r.principals = content.Principals
+	}
+
+	return r, nil
+}
+
+// -----------------------------------------------------------------------------
+
+func (r *fileRegistry) Register(principal, verifier string) error {
+	return r.update(func(p principals) error {
+		return p.register(principal, verifier, time.Now())
+	})
+}
+
+func (r *fileRegistry) Lookup(principal string) ([]string, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.principals.lookup(principal), nil
+}
+
+func (r *fileRegistry) Rotate(principal, oldVerifier, newVerifier string) error {
+	return r.update(func(p principals) error {
+		return p.rotate(principal, oldVerifier, newVerifier, time.Now())
+	})
+}
+
+func (r *fileRegistry) Disable(principal, verifier string) error {
+	return r.update(func(p principals) error {
+		return p.disable(principal, verifier)
+	})
+}
+
+func (r *fileRegistry) List(principal string) ([]Key, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.principals.list(principal), nil
+}
+
+// -----------------------------------------------------------------------------
+
+// Apply the update on a copy, it replaces the current state once persisted
+func (r *fileRegistry) update(fn func(principals) error) error {
+	r.Lock()
+	defer r.Unlock()
+
+	next := r.principals.clone()
+	if err := fn(next); err != nil {
+		return err
+	}
+	if err := r.persist(next); err != nil {
+		return err
+	}
+
+	r.principals = next
+
+	return nil
+}
+
+// Write the registry to a temporary file renamed over the current one
+func (r *fileRegistry) persist(p principals) error {
+	raw, err := json.MarshalIndent(fileContent{Principals: p}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("registry: Unable to encode registry, %v", err)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(r.path), filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("registry: Unable to create temporary file, %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(raw); err != nil {
+		f.Close()
+		return fmt.Errorf("registry: Unable to write temporary file, %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("registry: Unable to sync temporary file, %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("registry: Unable to close temporary file, %v", err)
+	}
+	if err := os.Rename(f.Name(), r.path); err != nil {
+		return fmt.Errorf("registry: Unable to replace registry file, %v", err)
+	}
+
+	return nil
+}
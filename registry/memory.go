@@ -0,0 +1,72 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registry
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryRegistry struct {
+	sync.RWMutex
+	principals principals
+}
+
+// NewMemoryRegistry returns a concurrency-safe in-memory registry
+func NewMemoryRegistry() Registry {
+	return &memoryRegistry{
+		principals: principals{},
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+func (r *memoryRegistry) Register(principal, verifier string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.principals.register(principal, verifier, time.Now())
+}
+
+func (r *memoryRegistry) Lookup(principal string) ([]string, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.principals.lookup(principal), nil
+}
+
+func (r *memoryRegistry) Rotate(principal, oldVerifier, newVerifier string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.principals.rotate(principal, oldVerifier, newVerifier, time.Now())
+}
+
+func (r *memoryRegistry) Disable(principal, verifier string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.principals.disable(principal, verifier)
+}
+
+func (r *memoryRegistry) List(principal string) ([]Key, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.principals.list(principal), nil
+}
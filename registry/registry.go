@@ -0,0 +1,143 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registry
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound raised when the key is not registered for the principal
+	ErrNotFound = errors.New("registry: Key not found")
+	// ErrAlreadyExists raised when trying to register an existing key
+	ErrAlreadyExists = errors.New("registry: Key already exists")
+	// ErrDisabled raised when trying to rotate a disabled key
+	ErrDisabled = errors.New("registry: Key is disabled")
+	// ErrInvalidKey raised when the principal or the verifier is empty
+	ErrInvalidKey = errors.New("registry: Principal and verifier must not be empty")
+)
+
+// Key is a sealed verifier registered for a principal
+type Key struct {
+	Verifier  string    `json:"verifier"`
+	CreatedAt time.Time `json:"created_at"`
+	Disabled  bool      `json:"disabled,omitempty"`
+}
+
+// Registry is the contract for principal sealed verifier storage
+type Registry interface {
+	// Register adds a verifier to the principal keys
+	Register(principal, verifier string) error
+	// Lookup returns the enabled verifiers of the principal, unknown
+	// principals have none.
+	Lookup(principal string) ([]string, error)
+	// Rotate atomically replaces an enabled verifier by a new one
+	Rotate(principal, oldVerifier, newVerifier string) error
+	// Disable prevents the verifier from being looked up, it is still listed
+	Disable(principal, verifier string) error
+	// List returns all the principal keys in registration order
+	List(principal string) ([]Key, error)
+}
+
+// -----------------------------------------------------------------------------
+
+// principals holds registered keys by principal
+type principals map[string][]Key
+
+func (p principals) register(principal, verifier string, now time.Time) error {
+	if principal == "" || verifier == "" {
+		return ErrInvalidKey
+	}
+	if p.index(principal, verifier) >= 0 {
+		return ErrAlreadyExists
+	}
+
+	p[principal] = append(p[principal], Key{
+		Verifier:  verifier,
+		CreatedAt: now.UTC(),
+	})
+
+	return nil
+}
+
+func (p principals) lookup(principal string) []string {
+	var verifiers []string
+	for _, k := range p[principal] {
+		if !k.Disabled {
+			verifiers = append(verifiers, k.Verifier)
+		}
+	}
+	return verifiers
+}
+
+func (p principals) rotate(principal, oldVerifier, newVerifier string, now time.Time) error {
+	if newVerifier == "" {
+		return ErrInvalidKey
+	}
+
+	i := p.index(principal, oldVerifier)
+	if i < 0 {
+		return ErrNotFound
+	}
+	if p[principal][i].Disabled {
+		return ErrDisabled
+	}
+	if p.index(principal, newVerifier) >= 0 {
+		return ErrAlreadyExists
+	}
+
+	p[principal][i] = Key{
+		Verifier:  newVerifier,
+		CreatedAt: now.UTC(),
+	}
+
+	return nil
+}
+
+func (p principals) disable(principal, verifier string) error {
+	i := p.index(principal, verifier)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	p[principal][i].Disabled = true
+
+	return nil
+}
+
+func (p principals) list(principal string) []Key {
+	return append([]Key(nil), p[principal]...)
+}
+
+func (p principals) index(principal, verifier string) int {
+	for i, k := range p[principal] {
+		if k.Verifier == verifier {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p principals) clone() principals {
+	c := make(principals, len(p))
+	for principal, keys := range p {
+		c[principal] = append([]Key(nil), keys...)
+	}
+	return c
+}
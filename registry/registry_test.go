@@ -0,0 +1,173 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registry_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"zntr.io/anvil/registry"
+
+	. "github.com/onsi/gomega"
+)
+
+func testRegistry(r registry.Registry) {
+	err := r.Register("toto", "v1")
+	Expect(err).To(BeNil(), "Error should be nil")
+	err = r.Register("toto", "v1")
+	Expect(err).To(Equal(registry.ErrAlreadyExists), "Key should already exist")
+	err = r.Register("", "v1")
+	Expect(err).To(Equal(registry.ErrInvalidKey), "Key should be invalid")
+	err = r.Register("toto", "v2")
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	verifiers, err := r.Lookup("toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifiers).To(Equal([]string{"v1", "v2"}), "Verifiers should match")
+
+	// Unknown principal
+	verifiers, err = r.Lookup("titi")
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifiers).To(BeEmpty(), "Verifiers should be empty")
+
+	// Rotate
+	err = r.Rotate("toto", "v1", "v3")
+	Expect(err).To(BeNil(), "Error should be nil")
+	err = r.Rotate("toto", "v1", "v4")
+	Expect(err).To(Equal(registry.ErrNotFound), "Key should not be found")
+	err = r.Rotate("toto", "v3", "v2")
+	Expect(err).To(Equal(registry.ErrAlreadyExists), "Key should already exist")
+	err = r.Rotate("titi", "v3", "v4")
+	Expect(err).To(Equal(registry.ErrNotFound), "Key should not be found")
+
+	// Disable
+	err = r.Disable("toto", "v2")
+	Expect(err).To(BeNil(), "Error should be nil")
+	err = r.Disable("toto", "v1")
+	Expect(err).To(Equal(registry.ErrNotFound), "Key should not be found")
+	err = r.Rotate("toto", "v2", "v4")
+	Expect(err).To(Equal(registry.ErrDisabled), "Key should be disabled")
+
+	verifiers, err = r.Lookup("toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifiers).To(Equal([]string{"v3"}), "Verifiers should match")
+
+	keys, err := r.List("toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(keys).To(HaveLen(2), "Keys should be listed")
+	Expect(keys[0].Verifier).To(Equal("v3"), "Rotated key should keep its position")
+	Expect(keys[0].Disabled).To(BeFalse(), "Rotated key should be enabled")
+	Expect(keys[0].CreatedAt.IsZero()).To(BeFalse(), "Creation time should be set")
+	Expect(keys[1].Verifier).To(Equal("v2"), "Disabled key should be listed")
+	Expect(keys[1].Disabled).To(BeTrue(), "Key should be disabled")
+
+	// Listed keys are copies
+	keys[0].Verifier = "v5"
+	verifiers, err = r.Lookup("toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifiers).To(Equal([]string{"v3"}), "Registry should not be altered")
+}
+
+func TestMemoryRegistry(t *testing.T) {
+	RegisterTestingT(t)
+
+	testRegistry(registry.NewMemoryRegistry())
+}
+
+func TestFileRegistry(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "registry")
+	Expect(err).To(BeNil(), "Error should be nil")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "registry.json")
+	r, err := registry.NewFileRegistry(path)
+	Expect(err).To(BeNil(), "Error should be nil")
+	testRegistry(r)
+
+	// Reload from file
+	reloaded, err := registry.NewFileRegistry(path)
+	Expect(err).To(BeNil(), "Error should be nil")
+	verifiers, err := reloaded.Lookup("toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifiers).To(Equal([]string{"v3"}), "Verifiers should be persisted")
+	keys, err := reloaded.List("toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(keys).To(HaveLen(2), "Disabled keys should be persisted")
+
+	// No temporary file left
+	entries, err := ioutil.ReadDir(dir)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(entries).To(HaveLen(1), "Only the registry file should exist")
+}
+
+func TestFileRegistryFailedUpdate(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "registry")
+	Expect(err).To(BeNil(), "Error should be nil")
+	defer os.RemoveAll(dir)
+
+	// Unwritable location
+	r, err := registry.NewFileRegistry(filepath.Join(dir, "missing", "registry.json"))
+	Expect(err).To(BeNil(), "Error should be nil")
+	err = r.Register("toto", "v1")
+	Expect(err).ToNot(BeNil(), "Error should be raised")
+
+	verifiers, err := r.Lookup("toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(verifiers).To(BeEmpty(), "Failed update should not be applied")
+
+	// Corrupted file
+	path := filepath.Join(dir, "registry.json")
+	Expect(ioutil.WriteFile(path, []byte("{"), 0600)).To(BeNil(), "Error should be nil")
+	_, err = registry.NewFileRegistry(path)
+	Expect(err).ToNot(BeNil(), "Error should be raised")
+}
+
+func TestMemoryRegistryConcurrentRotate(t *testing.T) {
+	RegisterTestingT(t)
+
+	r := registry.NewMemoryRegistry()
+	err := r.Register("toto", "v1")
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		rotated int
+	)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if r.Rotate("toto", "v1", string(rune('a'+i))) == nil {
+				mu.Lock()
+				rotated++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	Expect(rotated).To(Equal(1), "Key should be rotated exactly once")
+}
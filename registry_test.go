@@ -0,0 +1,118 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package anvil_test
+
+import (
+	"testing"
+	"time"
+
+	"zntr.io/anvil"
+	"zntr.io/anvil/forge"
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/registry"
+	"zntr.io/anvil/seal"
+	"zntr.io/anvil/session"
+	"zntr.io/anvil/tap"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestTapRegistry(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+	r := registry.NewMemoryRegistry()
+	store := session.NewMemoryStore(time.Minute)
+
+	login := func(password string) error {
+		verifiers, err := r.Lookup("toto")
+		Expect(err).To(BeNil(), "Error should be nil")
+		Expect(verifiers).ToNot(BeEmpty(), "Verifiers should be registered")
+		verifier, err := anvil.ParseVerifier(verifiers[0])
+		Expect(err).To(BeNil(), "Error should be nil")
+
+		challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt))
+		Expect(err).To(BeNil(), "Error should be nil")
+		token, err := anvil.Meld("toto", password, challenge)
+		Expect(err).To(BeNil(), "Error should be nil")
+		_, err = anvil.Tap(token, tap.WithRegistry(r))
+		return err
+	}
+
+	// Register account
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(params), forge.WithSessionStore(store))
+	Expect(err).To(BeNil(), "Error should be nil")
+	message, err := anvil.Register("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	registered, err := anvil.VerifyRegistration(message, tap.WithSessionStore(store))
+	Expect(err).To(BeNil(), "Error should be nil")
+	err = r.Register(registered.Principal, registered.Verifier)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	Expect(login("foo")).To(BeNil(), "Login should succeed")
+	Expect(login("bar")).ToNot(BeNil(), "Login should fail")
+
+	// Change password
+	verifier, err := anvil.ParseVerifier(registered.Verifier)
+	Expect(err).To(BeNil(), "Error should be nil")
+	challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	message, err = anvil.Reseal("toto", "foo", "bar", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	resealed, err := anvil.VerifyReseal(message, tap.WithRegistry(r))
+	Expect(err).To(BeNil(), "Error should be nil")
+	err = r.Rotate(resealed.Principal, resealed.Verifier, resealed.Upgrade)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	Expect(login("bar")).To(BeNil(), "Login should succeed")
+
+	// Disabled account
+	err = r.Disable("toto", resealed.Upgrade)
+	Expect(err).To(BeNil(), "Error should be nil")
+	challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "bar", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Tap(token, tap.WithRegistry(r))
+	Expect(err).To(MatchError(anvil.ErrUnregisteredPublicKey), "Error should be raised")
+}
+
+func TestTapRegistryInvalidEntry(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+	r := registry.NewMemoryRegistry()
+
+	sealed, err := anvil.Seal("toto", "foo", seal.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+	err = r.Register("toto", "not-a-verifier")
+	Expect(err).To(BeNil(), "Error should be nil")
+	err = r.Register("toto", sealed)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// Unparsable entry is skipped
+	verifier, err := anvil.ParseVerifier(sealed)
+	Expect(err).To(BeNil(), "Error should be nil")
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err := anvil.Tap(token, tap.WithRegistry(r))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result.Verifier).To(Equal(sealed), "Verifier should match")
+}
@@ -0,0 +1,127 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package anvil
+
+import (
+	"context"
+	"fmt"
+
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/meld"
+	"zntr.io/anvil/suite"
+	"zntr.io/anvil/tap"
+)
+
+// Reseal builds a password change message for a forged challenge, it carries
+// the verifier sealed from the new password signed by the key derived from
+// the old one. Upgrade parameters sent by the server are used for the new
+// verifier, current ones otherwise.
+func Reseal(principal, oldPassword, newPassword, challenge string, opts ...meld.Option) (string, error) {
+	return ResealContext(context.Background(), principal, oldPassword, newPassword, challenge, opts...)
+}
+
+// ResealContext builds a password change message, password derivations are
+// aborted when the context is done.
+func ResealContext(ctx context.Context, principal, oldPassword, newPassword, challenge string, opts ...meld.Option) (string, error) {
+	// Default settings
+	dopts := meld.Options{
+		KDF:    kdf.DefaultParams,
+		MaxKDF: kdf.DefaultMaxPolicy,
+		Suite:  suite.Default,
+		Clock:  meld.DefaultClock,
+		Leeway: meld.DefaultLeeway,
+	}
+
+	// Apply Options
+	for _, o := range opts {
+		o(&dopts)
+	}
+
+	// Decode and validate challenge
+	challengeRaw, envelope, err := openChallenge(principal, challenge, &dopts)
+	if err != nil {
+		return "", err
+	}
+
+	// Select new verifier parameters
+	params, err := verifierParams(envelope, &dopts)
+	if err != nil {
+		return "", err
+	}
+
+	// Seal new password
+	verifier, err := sealUpgrade(ctx, principal, newPassword, params, &dopts)
+	if err != nil {
+		return "", err
+	}
+
+	// Derive old password to get keys
+	signer, err := derivePassword(ctx, []byte(principal), []byte(oldPassword), dopts.Salt, dopts.Realm, dopts.KDF, dopts.Suite, dopts.Progress)
+	if err != nil {
+		return "", err
+	}
+	defer signer.Wipe()
+
+	// Sign reseal transcript with old private key
+	signatureRaw, err := signer.Sign(transcript(resealLabel, principal, dopts.Origin, challengeRaw, verifier))
+	if err != nil {
+		return "", fmt.Errorf("anvil: Unable to sign reseal message, %v", err)
+	}
+
+	// Public key could be resolved by the server
+	pub := signer.PublicKey()
+	if dopts.OmitPublicKey {
+		pub = nil
+	}
+
+	// Return message
+	return formatToken(resealV1, dopts.Suite, pub, challengeRaw, signatureRaw, verifier), nil
+}
+
+// VerifyReseal checks a password change message against the registered keys,
+// the result Upgrade verifier must replace the Verifier (or the key matching
+// KeyFingerprint) atomically. A public key or verifier resolver is required.
+func VerifyReseal(message string, opts ...tap.Option) (*TapResult, error) {
+	// Default settings
+	dopts := tap.Options{
+		Decryptor: tap.DefaultDecryptor,
+		Clock:     tap.DefaultClock,
+	}
+
+	// Apply Options
+	for _, o := range opts {
+		o(&dopts)
+	}
+
+	// Old key must be checked against registered ones
+	if dopts.PublicKeyResolver == nil && dopts.VerifierResolver == nil {
+		return nil, fmt.Errorf("%w, reseal verification requires a resolver", ErrKeyResolution)
+	}
+
+	// Decode message
+	t, err := parseToken(message, false)
+	if err != nil {
+		return nil, err
+	}
+	if t.Version != resealV1 {
+		return nil, fmt.Errorf("%w, '%s' messages are not reseal messages", ErrUnsupportedToken, t.Version)
+	}
+
+	// Verify message
+	return verifyToken(t, &dopts)
+}
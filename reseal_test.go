@@ -0,0 +1,164 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package anvil_test
+
+import (
+	"testing"
+	"time"
+
+	"zntr.io/anvil"
+	"zntr.io/anvil/forge"
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/meld"
+	"zntr.io/anvil/seal"
+	"zntr.io/anvil/session"
+	"zntr.io/anvil/tap"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestReseal(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+	registered, err := anvil.Seal("toto", "foo", seal.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+	verifier, err := anvil.ParseVerifier(registered)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	resolver := func(verifiers ...string) tap.Option {
+		return tap.WithVerifierResolver(func(principal string) ([]string, error) {
+			return verifiers, nil
+		})
+	}
+
+	// Change password
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	message, err := anvil.Reseal("toto", "foo", "bar", challenge, meld.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err := anvil.VerifyReseal(message, resolver(registered))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result.Principal).To(Equal("toto"), "Principal should match")
+	Expect(result.Verifier).To(Equal(registered), "Old verifier should be returned")
+	Expect(result.Upgrade).ToNot(BeEmpty(), "New verifier should be set")
+
+	resealed, err := anvil.ParseVerifier(result.Upgrade)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(resealed.KDF).To(Equal(params), "New verifier should keep parameters")
+	Expect(resealed.Salt).ToNot(Equal(verifier.Salt), "New verifier should use a fresh salt")
+
+	// New password is usable
+	challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(resealed.KDF), forge.WithSalt(resealed.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "bar", challenge, meld.WithKDFParams(resealed.KDF))
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Tap(token, resolver(result.Upgrade))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// Reseal message is not a login token
+	_, err = anvil.Tap(message, resolver(registered))
+	Expect(err).To(MatchError(anvil.ErrUnsupportedToken), "Error should be raised")
+
+	// Login token is not a reseal message
+	_, err = anvil.VerifyReseal(token, resolver(result.Upgrade))
+	Expect(err).ToNot(BeNil(), "Error should be raised")
+}
+
+func TestResealWrongPassword(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+	registered, err := anvil.Seal("toto", "foo", seal.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+	verifier, err := anvil.ParseVerifier(registered)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	message, err := anvil.Reseal("toto", "wrong", "bar", challenge, meld.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	_, err = anvil.VerifyReseal(message, tap.WithVerifierResolver(func(principal string) ([]string, error) {
+		return []string{registered}, nil
+	}))
+	Expect(err).To(MatchError(anvil.ErrUnregisteredPublicKey), "Error should be raised")
+}
+
+func TestResealRequiresResolver(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+	message, err := anvil.Reseal("toto", "foo", "bar", challenge, meld.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	_, err = anvil.VerifyReseal(message)
+	Expect(err).To(MatchError(anvil.ErrKeyResolution), "Error should be raised")
+}
+
+func TestResealReplay(t *testing.T) {
+	RegisterTestingT(t)
+
+	params := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+	registered, err := anvil.Seal("toto", "foo", seal.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+	verifier, err := anvil.ParseVerifier(registered)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	store := session.NewMemoryStore(time.Minute)
+	resolver := tap.WithVerifierResolver(func(principal string) ([]string, error) {
+		return []string{registered}, nil
+	})
+
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt), forge.WithSessionStore(store))
+	Expect(err).To(BeNil(), "Error should be nil")
+	message, err := anvil.Reseal("toto", "foo", "bar", challenge, meld.WithKDFParams(params))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	_, err = anvil.VerifyReseal(message, resolver, tap.WithSessionStore(store))
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.VerifyReseal(message, resolver, tap.WithSessionStore(store))
+	Expect(err).To(MatchError(anvil.ErrConsumedChallenge), "Error should be raised")
+}
+
+func TestResealUpgrade(t *testing.T) {
+	RegisterTestingT(t)
+
+	outdated := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+	current := kdf.Params{Algorithm: kdf.Scrypt, LogN: 11, R: 8, P: 1}
+	registered, err := anvil.Seal("toto", "foo", seal.WithKDFParams(outdated))
+	Expect(err).To(BeNil(), "Error should be nil")
+	verifier, err := anvil.ParseVerifier(registered)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt), forge.WithUpgrade(current))
+	Expect(err).To(BeNil(), "Error should be nil")
+	message, err := anvil.Reseal("toto", "foo", "bar", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	result, err := anvil.VerifyReseal(message, tap.WithVerifierResolver(func(principal string) ([]string, error) {
+		return []string{registered}, nil
+	}))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	resealed, err := anvil.ParseVerifier(result.Upgrade)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(resealed.KDF).To(Equal(current), "New verifier should use requested parameters")
+}
@@ -0,0 +1,42 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package anvil
+
+import "time"
+
+// TapResult describes a verified challenge
+type TapResult struct {
+	Principal  string
+	SessionID  string
+	IssuedAt   time.Time
+	Expiration time.Time
+	Issuer     string
+	Audience   string
+	Claims     map[string]string
+	// KeyFingerprint is the base64url encoded SHA-256 of the matching public key
+	KeyFingerprint string
+	// Verifier is the matching registered verifier, it is only known with a
+	// verifier resolver
+	Verifier string
+	// NeedsUpgrade is set when the matching verifier is sealed below the
+	// policy minimum cost
+	NeedsUpgrade bool
+	// Upgrade is the new verifier sealed by the client on server request, it
+	// is signed with the matching key and should replace Verifier atomically
+	Upgrade string
+}
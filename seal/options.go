@@ -0,0 +1,84 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package seal
+
+import (
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/suite"
+)
+
+// Options for credential sealing
+type Options struct {
+	KDF      kdf.Params
+	Salt     []byte
+	Realm    string
+	Suite    suite.Suite
+	FIPS     bool
+	Progress kdf.ProgressFunc
+}
+
+// Option defines seal option contract option function
+type Option func(*Options)
+
+// WithKDFParams defines the password key derivation parameters
+func WithKDFParams(params kdf.Params) Option {
+	return func(opts *Options) {
+		opts.KDF = params
+	}
+}
+
+// WithSalt defines the key derivation salt, a random one is generated by default
+func WithSalt(salt []byte) Option {
+	return func(opts *Options) {
+		opts.Salt = salt
+	}
+}
+
+// WithRealm defines the application realm bound to the key derivation, the
+// same password produces different keys for different realms.
+func WithRealm(realm string) Option {
+	return func(opts *Options) {
+		opts.Realm = realm
+	}
+}
+
+// WithSuite defines the signature suite, Ed25519 is used by default
+func WithSuite(s suite.Suite) Option {
+	return func(opts *Options) {
+		opts.Suite = s
+	}
+}
+
+// WithFIPS enables the FIPS profile, it defaults to PBKDF2-HMAC-SHA256 and
+// ECDSA P-256 and refuses non-approved algorithms. Following options could
+// override approved parameters.
+func WithFIPS() Option {
+	return func(opts *Options) {
+		opts.FIPS = true
+		opts.KDF = kdf.DefaultPBKDF2Params
+		opts.Suite = suite.P256
+	}
+}
+
+// WithProgress defines the key derivation progress callback, it receives
+// values between 0 and 1.
+func WithProgress(progress kdf.ProgressFunc) Option {
+	return func(opts *Options) {
+		opts.Progress = progress
+	}
+}
@@ -0,0 +1,111 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+type entry struct {
+	principal  string
+	expiration time.Time
+}
+
+type memoryStore struct {
+	sync.Mutex
+	sessions      map[string]entry
+	sweepInterval time.Duration
+	lastSweep     time.Time
+	clock         ClockFunc
+	leeway        time.Duration
+}
+
+// NewMemoryStore returns a concurrency-safe in-memory session store, expired
+// sessions are evicted every sweep interval.
+func NewMemoryStore(sweepInterval time.Duration, opts ...Option) Store {
+	// Default settings
+	dopts := Options{
+		Clock: DefaultClock,
+	}
+
+	// Apply Options
+	for _, o := range opts {
+		o(&dopts)
+	}
+
+	return &memoryStore{
+		sessions:      map[string]entry{},
+		sweepInterval: sweepInterval,
+		lastSweep:     dopts.Clock(),
+		clock:         dopts.Clock,
+		leeway:        dopts.Leeway,
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+func (s *memoryStore) Put(sessionID, principal string, expiration time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.clock()
+
+	// Evict expired sessions
+	if now.Sub(s.lastSweep) >= s.sweepInterval {
+		for id, e := range s.sessions {
+			if now.After(e.expiration) {
+				delete(s.sessions, id)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	// Session identifiers must be unique
+	if e, ok := s.sessions[sessionID]; ok && !now.After(e.expiration) {
+		return ErrAlreadyExists
+	}
+
+	// Sessions are kept during the leeway
+	s.sessions[sessionID] = entry{
+		principal:  principal,
+		expiration: expiration.Add(s.leeway),
+	}
+
+	return nil
+}
+
+func (s *memoryStore) Consume(sessionID, principal string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	e, ok := s.sessions[sessionID]
+	if !ok || e.principal != principal {
+		return ErrNotFound
+	}
+
+	// Session is consumed whatever happens
+	delete(s.sessions, sessionID)
+
+	// Check expiration
+	if s.clock().After(e.expiration) {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package session_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"zntr.io/anvil/session"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestMemoryStore(t *testing.T) {
+	RegisterTestingT(t)
+
+	store := session.NewMemoryStore(time.Minute)
+
+	err := store.Put("123", "toto", time.Now().Add(time.Minute))
+	Expect(err).To(BeNil(), "Error should be nil")
+	err = store.Put("123", "titi", time.Now().Add(time.Minute))
+	Expect(err).To(Equal(session.ErrAlreadyExists), "Session should already exist")
+
+	// Principal mismatch
+	err = store.Consume("123", "titi")
+	Expect(err).To(Equal(session.ErrNotFound), "Session should not be found")
+
+	// Consumed once
+	err = store.Consume("123", "toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+	err = store.Consume("123", "toto")
+	Expect(err).To(Equal(session.ErrNotFound), "Session should not be found")
+
+	// Expired session
+	err = store.Put("456", "toto", time.Now().Add(-time.Second))
+	Expect(err).To(BeNil(), "Error should be nil")
+	err = store.Consume("456", "toto")
+	Expect(err).To(Equal(session.ErrNotFound), "Session should not be found")
+}
+
+func TestMemoryStoreConcurrentConsume(t *testing.T) {
+	RegisterTestingT(t)
+
+	store := session.NewMemoryStore(0)
+	err := store.Put("123", "toto", time.Now().Add(time.Minute))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	var (
+		wg       sync.WaitGroup
+		consumed int32
+	)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if store.Consume("123", "toto") == nil {
+				atomic.AddInt32(&consumed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	Expect(consumed).To(Equal(int32(1)), "Session should be consumed exactly once")
+}
+
+func TestMemoryStoreClock(t *testing.T) {
+	RegisterTestingT(t)
+
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	store := session.NewMemoryStore(time.Minute, session.WithClock(func() time.Time {
+		return now
+	}))
+
+	// Expiration is checked against the store clock
+	err := store.Put("123", "toto", now.Add(time.Minute))
+	Expect(err).To(BeNil(), "Error should be nil")
+	err = store.Consume("123", "toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	err = store.Put("456", "toto", now.Add(time.Minute))
+	Expect(err).To(BeNil(), "Error should be nil")
+	now = now.Add(2 * time.Minute)
+	err = store.Consume("456", "toto")
+	Expect(err).To(Equal(session.ErrNotFound), "Session should be expired")
+}
+
+func TestMemoryStoreLeeway(t *testing.T) {
+	RegisterTestingT(t)
+
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	store := session.NewMemoryStore(time.Minute, session.WithLeeway(30*time.Second), session.WithClock(func() time.Time {
+		return now
+	}))
+
+	err := store.Put("123", "toto", now.Add(time.Minute))
+	Expect(err).To(BeNil(), "Error should be nil")
+	err = store.Put("456", "toto", now.Add(time.Minute))
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// Within leeway
+	now = now.Add(80 * time.Second)
+	err = store.Consume("123", "toto")
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	// Beyond leeway
+	now = now.Add(20 * time.Second)
+	err = store.Consume("456", "toto")
+	Expect(err).To(Equal(session.ErrNotFound), "Session should be expired")
+}
@@ -0,0 +1,40 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package session
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound raised when the session does not exist, has expired or has already been consumed
+	ErrNotFound = errors.New("session: Session not found")
+	// ErrAlreadyExists raised when trying to register an existing session
+	ErrAlreadyExists = errors.New("session: Session already exists")
+)
+
+// Store is the contract for forged challenge session storage
+type Store interface {
+	// Put registers a forged session until its expiration
+	Put(sessionID, principal string, expiration time.Time) error
+	// Consume atomically removes the session matching the principal, a
+	// session can only be consumed once. ErrNotFound must be returned for
+	// missing sessions, other errors are storage failures.
+	Consume(sessionID, principal string) error
+}
@@ -0,0 +1,75 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package suite
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+type ed25519Suite struct{}
+
+func (ed25519Suite) Name() string {
+	return "ed25519"
+}
+
+func (ed25519Suite) DeriveKey(material []byte) (Signer, error) {
+	if len(material) < ed25519.SeedSize {
+		return nil, fmt.Errorf("suite: Ed25519 key material must be at least %d bytes", ed25519.SeedSize)
+	}
+
+	// Use the first 32 bytes as seed
+	return ed25519Signer(ed25519.NewKeyFromSeed(material[:ed25519.SeedSize])), nil
+}
+
+func (ed25519Suite) SignatureSize() int {
+	return ed25519.SignatureSize
+}
+
+func (ed25519Suite) ValidatePublicKey(publicKey []byte) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("suite: Invalid Ed25519 public key size")
+	}
+	return nil
+}
+
+func (ed25519Suite) Verify(publicKey, message, signature []byte) bool {
+	if len(publicKey) != ed25519.PublicKeySize || len(signature) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(publicKey, message, signature)
+}
+
+// -----------------------------------------------------------------------------
+
+type ed25519Signer ed25519.PrivateKey
+
+func (s ed25519Signer) PublicKey() []byte {
+	return ed25519.PrivateKey(s).Public().(ed25519.PublicKey)
+}
+
+func (s ed25519Signer) Sign(message []byte) ([]byte, error) {
+	return ed25519.Sign(ed25519.PrivateKey(s), message), nil
+}
+
+func (s ed25519Signer) Wipe() {
+	for i := range s {
+		s[i] = 0
+	}
+}
@@ -0,0 +1,129 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package suite
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+const p256ScalarSize = 32
+
+type p256Suite struct{}
+
+func (p256Suite) Name() string {
+	return "p256"
+}
+
+// DeriveKey uses the FIPS 186-4 B.4.1 extra random bits method, the scalar is
+// computed as d = (material mod (n-1)) + 1.
+func (p256Suite) DeriveKey(material []byte) (Signer, error) {
+	if len(material) < MaterialSize {
+		return nil, fmt.Errorf("suite: P-256 key material must be at least %d bytes", MaterialSize)
+	}
+
+	curve := elliptic.P256()
+	nMinusOne := new(big.Int).Sub(curve.Params().N, big.NewInt(1))
+
+	// Compute private scalar
+	d := new(big.Int).SetBytes(material[:MaterialSize])
+	d.Mod(d, nMinusOne)
+	d.Add(d, big.NewInt(1))
+
+	// Compute public point
+	priv := &ecdsa.PrivateKey{D: d}
+	priv.PublicKey.Curve = curve
+	priv.PublicKey.X, priv.PublicKey.Y = curve.ScalarBaseMult(scalarBytes(d))
+
+	return &p256Signer{priv: priv}, nil
+}
+
+func (p256Suite) SignatureSize() int {
+	return 2 * p256ScalarSize
+}
+
+func (p256Suite) ValidatePublicKey(publicKey []byte) error {
+	if x, _ := elliptic.Unmarshal(elliptic.P256(), publicKey); x == nil {
+		return fmt.Errorf("suite: Invalid P-256 public key")
+	}
+	return nil
+}
+
+func (p256Suite) Verify(publicKey, message, signature []byte) bool {
+	if len(signature) != 2*p256ScalarSize {
+		return false
+	}
+
+	// Decode public key
+	x, y := elliptic.Unmarshal(elliptic.P256(), publicKey)
+	if x == nil {
+		return false
+	}
+
+	// Decode signature
+	r := new(big.Int).SetBytes(signature[:p256ScalarSize])
+	s := new(big.Int).SetBytes(signature[p256ScalarSize:])
+
+	h := sha256.Sum256(message)
+	return ecdsa.Verify(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, h[:], r, s)
+}
+
+// -----------------------------------------------------------------------------
+
+type p256Signer struct {
+	priv *ecdsa.PrivateKey
+}
+
+// PublicKey returns the uncompressed SEC1 encoded public point
+func (s *p256Signer) PublicKey() []byte {
+	return elliptic.Marshal(s.priv.Curve, s.priv.X, s.priv.Y)
+}
+
+// Sign returns the signature encoded as r || s
+func (s *p256Signer) Sign(message []byte) ([]byte, error) {
+	h := sha256.Sum256(message)
+	r, ss, err := ecdsa.Sign(rand.Reader, s.priv, h[:])
+	if err != nil {
+		return nil, fmt.Errorf("suite: Unable to sign message, %v", err)
+	}
+
+	return append(scalarBytes(r), scalarBytes(ss)...), nil
+}
+
+// Wipe zeroes the private scalar
+func (s *p256Signer) Wipe() {
+	words := s.priv.D.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	s.priv.D.SetInt64(0)
+}
+
+// -----------------------------------------------------------------------------
+
+// scalarBytes returns the big-endian scalar left padded to 32 bytes
+func scalarBytes(k *big.Int) []byte {
+	out := make([]byte, p256ScalarSize)
+	b := k.Bytes()
+	copy(out[p256ScalarSize-len(b):], b)
+	return out
+}
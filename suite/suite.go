@@ -0,0 +1,71 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package suite
+
+import (
+	"fmt"
+)
+
+// Suite is a signature scheme with deterministic key derivation
+type Suite interface {
+	// Name returns the suite identifier used in verifiers and tokens
+	Name() string
+	// DeriveKey derives a key pair from 64 bytes of uniformly random key material
+	DeriveKey(material []byte) (Signer, error)
+	// SignatureSize returns the encoded signature size
+	SignatureSize() int
+	// ValidatePublicKey checks the encoded public key
+	ValidatePublicKey(publicKey []byte) error
+	// Verify checks the signature of the message, it must not panic on invalid inputs
+	Verify(publicKey, message, signature []byte) bool
+}
+
+// Signer holds a derived key pair
+type Signer interface {
+	// PublicKey returns the encoded public key
+	PublicKey() []byte
+	// Sign the message
+	Sign(message []byte) ([]byte, error)
+	// Wipe zeroes the private key material, the signer must not be used after
+	Wipe()
+}
+
+// MaterialSize is the key derivation material size expected by suites
+const MaterialSize = 64
+
+var (
+	// Ed25519 uses Ed25519 signatures (default)
+	Ed25519 Suite = ed25519Suite{}
+	// P256 uses ECDSA P-256 with SHA-256 signatures
+	P256 Suite = p256Suite{}
+
+	// Default is the default signature suite
+	Default = Ed25519
+)
+
+// Lookup returns the suite matching the given name
+func Lookup(name string) (Suite, error) {
+	switch name {
+	case Ed25519.Name():
+		return Ed25519, nil
+	case P256.Name():
+		return P256, nil
+	default:
+		return nil, fmt.Errorf("suite: Unsupported signature suite '%s'", name)
+	}
+}
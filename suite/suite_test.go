@@ -0,0 +1,71 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package suite_test
+
+import (
+	"bytes"
+	"testing"
+
+	"zntr.io/anvil/suite"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSuites(t *testing.T) {
+	RegisterTestingT(t)
+
+	material := bytes.Repeat([]byte{0x42}, suite.MaterialSize)
+	message := []byte("challenge")
+
+	for _, s := range []suite.Suite{suite.Ed25519, suite.P256} {
+		found, err := suite.Lookup(s.Name())
+		Expect(err).To(BeNil(), "Error should be nil")
+		Expect(found).To(Equal(s), "Suite should be resolved by name")
+
+		// Deterministic derivation
+		signer, err := s.DeriveKey(material)
+		Expect(err).To(BeNil(), "Error should be nil")
+		other, err := s.DeriveKey(material)
+		Expect(err).To(BeNil(), "Error should be nil")
+		Expect(signer.PublicKey()).To(Equal(other.PublicKey()), "Derivation should be deterministic")
+		Expect(s.ValidatePublicKey(signer.PublicKey())).To(BeNil(), "Public key should be valid")
+
+		// Sign and verify
+		sig, err := signer.Sign(message)
+		Expect(err).To(BeNil(), "Error should be nil")
+		Expect(sig).To(HaveLen(s.SignatureSize()), "Signature size should match")
+		Expect(s.Verify(signer.PublicKey(), message, sig)).To(BeTrue(), "Signature should be valid")
+		Expect(s.Verify(signer.PublicKey(), []byte("other"), sig)).To(BeFalse(), "Signature should be invalid")
+		Expect(s.Verify(signer.PublicKey(), message, sig[:10])).To(BeFalse(), "Signature should be invalid")
+		Expect(s.Verify([]byte{0x01}, message, sig)).To(BeFalse(), "Signature should be invalid")
+
+		// Invalid inputs
+		_, err = s.DeriveKey(material[:16])
+		Expect(err).ToNot(BeNil(), "Error should not be nil")
+		Expect(s.ValidatePublicKey([]byte{0x01})).ToNot(BeNil(), "Public key should be invalid")
+	}
+
+	// Suites derive distinct keys
+	ed, _ := suite.Ed25519.DeriveKey(material)
+	p, _ := suite.P256.DeriveKey(material)
+	Expect(ed.PublicKey()).ToNot(Equal(p.PublicKey()), "Public keys should differ")
+	Expect(suite.Ed25519.Verify(p.PublicKey(), message, make([]byte, 64))).To(BeFalse(), "Signature should be invalid")
+
+	_, err := suite.Lookup("rsa")
+	Expect(err).ToNot(BeNil(), "Error should not be nil")
+}
@@ -0,0 +1,70 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package tap
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// AuthenticatorVerifierFunc is the contract for challenge server authenticator
+// verification, the payload covers the challenge and the derivation parameters
+// of the envelope.
+type AuthenticatorVerifierFunc func(keyID string, payload, tag []byte) error
+
+// HMACVerifier verifies HMAC-SHA256 challenge authenticators, keys are indexed by key identifier
+func HMACVerifier(keys map[string][]byte) AuthenticatorVerifierFunc {
+	return func(keyID string, payload, tag []byte) error {
+		key, ok := keys[keyID]
+		if !ok || len(key) == 0 {
+			return fmt.Errorf("tap: Unknown authenticator key '%s'", keyID)
+		}
+
+		// Compute payload MAC
+		h := hmac.New(sha256.New, key)
+		h.Write(payload)
+
+		// Compare in constant time
+		if !hmac.Equal(h.Sum(nil), tag) {
+			return errors.New("tap: Invalid challenge authenticator")
+		}
+
+		return nil
+	}
+}
+
+// Ed25519Verifier verifies Ed25519 challenge authenticators, keys are indexed by key identifier
+func Ed25519Verifier(keys map[string]ed25519.PublicKey) AuthenticatorVerifierFunc {
+	return func(keyID string, payload, tag []byte) error {
+		key, ok := keys[keyID]
+		if !ok || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("tap: Unknown authenticator key '%s'", keyID)
+		}
+
+		// Check signature
+		if !ed25519.Verify(key, payload, tag) {
+			return errors.New("tap: Invalid challenge authenticator")
+		}
+
+		return nil
+	}
+}
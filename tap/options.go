@@ -17,12 +17,49 @@
 
 package tap
 
+import (
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/keyring"
+	"zntr.io/anvil/registry"
+	"zntr.io/anvil/session"
+)
+
+// ClockFunc is the contract for current time provider
+type ClockFunc func() time.Time
+
 // ProcessorFunc contract for challenge pre/post processing
 type ProcessorFunc func([]byte) ([]byte, error)
 
+// PublicKeyResolverFunc is the contract for registered Ed25519 public key lookup
+type PublicKeyResolverFunc func(principal string) ([]ed25519.PublicKey, error)
+
+// VerifierResolverFunc is the contract for registered sealed verifier lookup
+type VerifierResolverFunc func(principal string) ([]string, error)
+
+// ClaimsValidatorFunc is the contract for custom claims validation
+type ClaimsValidatorFunc func(claims map[string]string) error
+
 // Options for challenge forging
 type Options struct {
-	Decryptor ProcessorFunc
+	Decryptor             ProcessorFunc
+	PublicKeyResolver     PublicKeyResolverFunc
+	VerifierResolver      VerifierResolverFunc
+	AuthenticatorVerifier AuthenticatorVerifierFunc
+	SessionStore          session.Store
+	Clock                 ClockFunc
+	Leeway                time.Duration
+	Issuer                string
+	Audience              string
+	ClaimsValidator       ClaimsValidatorFunc
+	Origin                string
+	AllowLegacyTokens     bool
+	Keyring               *keyring.Keyring
+	KDFPolicy             kdf.Policy
+	FIPS                  bool
 }
 
 // Option defines forge option contract option function
@@ -35,6 +72,122 @@ func WithDecryptor(decryptor ProcessorFunc) Option {
 	}
 }
 
+// WithPublicKeyResolver defines the registered public key resolver
+func WithPublicKeyResolver(resolver PublicKeyResolverFunc) Option {
+	return func(opts *Options) {
+		opts.PublicKeyResolver = resolver
+	}
+}
+
+// WithVerifierResolver defines the registered sealed verifier resolver, it
+// supports all signature suites.
+func WithVerifierResolver(resolver VerifierResolverFunc) Option {
+	return func(opts *Options) {
+		opts.VerifierResolver = resolver
+	}
+}
+
+// WithRegistry defines the registry used to resolve the principal enabled
+// verifiers, it replaces the verifier resolver.
+func WithRegistry(r registry.Registry) Option {
+	return func(opts *Options) {
+		opts.VerifierResolver = r.Lookup
+	}
+}
+
+// WithAuthenticatorVerifier defines the challenge server authenticator verifier,
+// challenges without a valid authenticator are rejected.
+func WithAuthenticatorVerifier(verifier AuthenticatorVerifierFunc) Option {
+	return func(opts *Options) {
+		opts.AuthenticatorVerifier = verifier
+	}
+}
+
+// WithSessionStore defines the store used to consume forged sessions, a
+// challenge could only be tapped once. The store must tolerate the same
+// leeway.
+func WithSessionStore(store session.Store) Option {
+	return func(opts *Options) {
+		opts.SessionStore = store
+	}
+}
+
+// WithClock defines the time provider used for challenge validation
+func WithClock(clock ClockFunc) Option {
+	return func(opts *Options) {
+		opts.Clock = clock
+	}
+}
+
+// WithLeeway defines the tolerated clock skew between forging and tapping nodes
+func WithLeeway(leeway time.Duration) Option {
+	return func(opts *Options) {
+		opts.Leeway = leeway
+	}
+}
+
+// WithIssuer defines the expected challenge issuer
+func WithIssuer(issuer string) Option {
+	return func(opts *Options) {
+		opts.Issuer = issuer
+	}
+}
+
+// WithAudience defines the expected challenge audience
+func WithAudience(audience string) Option {
+	return func(opts *Options) {
+		opts.Audience = audience
+	}
+}
+
+// WithClaimsValidator defines the custom claims validator, challenges are
+// rejected when it returns an error.
+func WithClaimsValidator(validator ClaimsValidatorFunc) Option {
+	return func(opts *Options) {
+		opts.ClaimsValidator = validator
+	}
+}
+
+// WithOrigin defines the expected origin bound by the client in the signature
+func WithOrigin(origin string) Option {
+	return func(opts *Options) {
+		opts.Origin = origin
+	}
+}
+
+// WithLegacyTokens allows unversioned three parts tokens, they are Ed25519
+// signatures of the bare challenge without envelope nor origin binding.
+func WithLegacyTokens() Option {
+	return func(opts *Options) {
+		opts.AllowLegacyTokens = true
+	}
+}
+
+// WithKDFPolicy defines the current minimum key derivation cost, results of
+// verifiers sealed below it are flagged as needing upgrade. It requires a
+// verifier resolver.
+func WithKDFPolicy(policy kdf.Policy) Option {
+	return func(opts *Options) {
+		opts.KDFPolicy = policy
+	}
+}
+
+// WithKeyring defines the keyring used to decrypt challenges
+func WithKeyring(kr *keyring.Keyring) Option {
+	return func(opts *Options) {
+		opts.Keyring = kr
+		opts.Decryptor = kr.Decrypt
+	}
+}
+
+// WithFIPS enables the FIPS profile, only ECDSA P-256 tokens with challenges
+// encrypted by an AES-GCM keyring are accepted.
+func WithFIPS() Option {
+	return func(opts *Options) {
+		opts.FIPS = true
+	}
+}
+
 var (
 	// NoOperationProcessor defines the copy source processor
 	NoOperationProcessor = func(payload []byte) ([]byte, error) {
@@ -43,4 +196,7 @@ var (
 
 	// DefaultDecryptor is the default data decryptor for challenge
 	DefaultDecryptor = NoOperationProcessor
+
+	// DefaultClock is the default time provider
+	DefaultClock = time.Now
 )
@@ -0,0 +1,128 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package anvil
+
+import (
+	"fmt"
+	"strings"
+
+	"zntr.io/anvil/suite"
+)
+
+const (
+	// tokenLegacy is the version of unlabeled tokens: <public key>.<challenge>.<signature>
+	tokenLegacy = ""
+	// tokenV1 prefixes version 1 tokens: anvil1.<suite>.<public key>.<challenge>.<signature>[.<upgrade>]
+	tokenV1 = "anvil1"
+	// resealV1 prefixes version 1 reseal messages: anvil1-reseal.<suite>.<public key>.<challenge>.<signature>.<verifier>
+	resealV1 = "anvil1-reseal"
+	// registerV1 prefixes version 1 registration messages: anvil1-register.<suite>.<public key>.<challenge>.<signature>.<verifier>
+	registerV1 = "anvil1-register"
+)
+
+// token holds decoded token parts
+type token struct {
+	Version   string
+	Suite     suite.Suite
+	PublicKey []byte
+	Challenge []byte
+	Signature []byte
+	Upgrade   []byte
+}
+
+// formatToken encodes a version 1 token, reseal or registration message, the
+// upgrade verifier is optional for tokens.
+func formatToken(version string, s suite.Suite, publicKey, challenge, signature, upgrade []byte) string {
+	parts := []string{
+		version,
+		s.Name(),
+		toOKP(publicKey),
+		toOKP(challenge),
+		toOKP(signature),
+	}
+	if len(upgrade) > 0 {
+		parts = append(parts, toOKP(upgrade))
+	}
+	return strings.Join(parts, ".")
+}
+
+// parseToken decodes a token according to its version, legacy tokens are
+// three unlabeled parts (publicKey, challenge, signature) signed with Ed25519.
+func parseToken(value string, allowLegacy bool) (*token, error) {
+	parts := strings.Split(value, ".")
+
+	// Dispatch on version
+	var (
+		t         token
+		suiteName string
+	)
+	switch {
+	case parts[0] == tokenV1:
+		// Must have 5 parts (version, suite, publicKey, challenge, signature)
+		// and an optional upgrade verifier
+		if len(parts) != 5 && len(parts) != 6 {
+			return nil, fmt.Errorf("%w, it must contains 5 or 6 parts", ErrMalformedToken)
+		}
+		t.Version, suiteName, parts = tokenV1, parts[1], parts[2:]
+	case parts[0] == resealV1, parts[0] == registerV1:
+		// Must have 6 parts (version, suite, publicKey, challenge, signature, verifier)
+		if len(parts) != 6 {
+			return nil, fmt.Errorf("%w, it must contains 6 parts", ErrMalformedToken)
+		}
+		t.Version, suiteName, parts = parts[0], parts[1], parts[2:]
+	case len(parts) == 3:
+		if !allowLegacy {
+			return nil, fmt.Errorf("%w, legacy tokens are not allowed", ErrUnsupportedToken)
+		}
+		t.Version, suiteName = tokenLegacy, suite.Ed25519.Name()
+	case len(parts) < 3:
+		return nil, fmt.Errorf("%w, it must contains at least 3 parts", ErrMalformedToken)
+	default:
+		return nil, fmt.Errorf("%w, unknown token version", ErrUnsupportedToken)
+	}
+
+	// Resolve signature suite
+	var err error
+	if t.Suite, err = suite.Lookup(suiteName); err != nil {
+		return nil, fmt.Errorf("%w, %v", ErrUnsupportedToken, err)
+	}
+
+	// Decode PublicKey
+	if t.PublicKey, err = fromOKP(parts[0]); err != nil {
+		return nil, fmt.Errorf("%w, invalid public key: %v", ErrMalformedToken, err)
+	}
+
+	// Decode challenge
+	if t.Challenge, err = fromOKP(parts[1]); err != nil {
+		return nil, fmt.Errorf("%w, unable to decode challenge: %v", ErrMalformedToken, err)
+	}
+
+	// Decode signature
+	if t.Signature, err = fromOKP(parts[2]); err != nil {
+		return nil, fmt.Errorf("%w, invalid challenge signature encoding: %v", ErrMalformedToken, err)
+	}
+
+	// Decode upgrade verifier
+	if len(parts) == 4 {
+		if t.Upgrade, err = fromOKP(parts[3]); err != nil || len(t.Upgrade) == 0 {
+			return nil, fmt.Errorf("%w, invalid upgrade verifier encoding", ErrMalformedToken)
+		}
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,107 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package anvil_test
+
+import (
+	"strings"
+	"testing"
+
+	"zntr.io/anvil"
+	"zntr.io/anvil/forge"
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/seal"
+	"zntr.io/anvil/tap"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestVerifierUpgrade(t *testing.T) {
+	RegisterTestingT(t)
+
+	outdated := kdf.Params{Algorithm: kdf.Scrypt, LogN: 10, R: 8, P: 1}
+	current := kdf.Params{Algorithm: kdf.Scrypt, LogN: 11, R: 8, P: 1}
+	policy := kdf.Policy{current}
+
+	registered, err := anvil.Seal("toto", "foo", seal.WithKDFParams(outdated))
+	Expect(err).To(BeNil(), "Error should be nil")
+	verifier, err := anvil.ParseVerifier(registered)
+	Expect(err).To(BeNil(), "Error should be nil")
+
+	resolver := func(verifiers ...string) tap.Option {
+		return tap.WithVerifierResolver(func(principal string) ([]string, error) {
+			return verifiers, nil
+		})
+	}
+
+	// Outdated verifier without upgrade request
+	challenge, _, err := anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	plain, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err := anvil.Tap(plain, resolver(registered), tap.WithKDFPolicy(policy))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result.Verifier).To(Equal(registered), "Matching verifier should be returned")
+	Expect(result.NeedsUpgrade).To(BeTrue(), "Result should need upgrade")
+	Expect(result.Upgrade).To(BeEmpty(), "Upgrade should be empty")
+
+	// Server requests an upgrade
+	challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt), forge.WithUpgrade(current))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(strings.Split(token, ".")).To(HaveLen(6), "Token should carry the upgrade")
+	result, err = anvil.Tap(token, resolver(registered), tap.WithKDFPolicy(policy))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result.NeedsUpgrade).To(BeTrue(), "Result should need upgrade")
+	Expect(result.Upgrade).ToNot(BeEmpty(), "Upgrade should be set")
+
+	upgraded, err := anvil.ParseVerifier(result.Upgrade)
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(upgraded.KDF).To(Equal(current), "Upgrade should use requested parameters")
+	Expect(upgraded.Salt).ToNot(Equal(verifier.Salt), "Upgrade should use a fresh salt")
+
+	// Upgraded verifier is usable
+	challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(upgraded.KDF), forge.WithSalt(upgraded.Salt))
+	Expect(err).To(BeNil(), "Error should be nil")
+	next, err := anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	result, err = anvil.Tap(next, resolver(result.Upgrade), tap.WithKDFPolicy(policy))
+	Expect(err).To(BeNil(), "Error should be nil")
+	Expect(result.NeedsUpgrade).To(BeFalse(), "Result should not need upgrade")
+
+	// Stripped upgrade
+	parts := strings.Split(token, ".")
+	_, err = anvil.Tap(strings.Join(parts[:5], "."), resolver(registered))
+	Expect(err).To(MatchError(anvil.ErrInvalidSignature), "Error should be invalid signature")
+
+	// Unsolicited upgrade
+	_, err = anvil.Tap(plain+"."+parts[5], resolver(registered))
+	Expect(err).To(MatchError(anvil.ErrMalformedToken), "Error should be malformed token")
+
+	// Upgrade below policy
+	challenge, _, err = anvil.Forge("toto", forge.WithKDFParams(verifier.KDF), forge.WithSalt(verifier.Salt), forge.WithUpgrade(outdated))
+	Expect(err).To(BeNil(), "Error should be nil")
+	token, err = anvil.Meld("toto", "foo", challenge)
+	Expect(err).To(BeNil(), "Error should be nil")
+	_, err = anvil.Tap(token, resolver(registered), tap.WithKDFPolicy(policy))
+	Expect(err).To(MatchError(anvil.ErrWeakVerifier), "Error should be weak verifier")
+
+	// Invalid upgrade parameters
+	_, _, err = anvil.Forge("toto", forge.WithUpgrade(kdf.Params{Algorithm: kdf.Scrypt}))
+	Expect(err).ToNot(BeNil(), "Error should not be nil")
+}
@@ -0,0 +1,136 @@
+// Licensed to Anvil under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Anvil licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package anvil
+
+import (
+	"fmt"
+	"strings"
+
+	"zntr.io/anvil/kdf"
+	"zntr.io/anvil/suite"
+)
+
+const verifierVersion = 1
+
+// Verifier is the sealed public key with its signature suite, key derivation
+// parameters and salt, it must be stored by the server for the principal.
+//
+// Encoding: $anvil$v=1$<suite>$<kdf algorithm>$<kdf parameters>$<salt>$<public key>
+type Verifier struct {
+	Suite     suite.Suite
+	KDF       kdf.Params
+	Salt      []byte
+	PublicKey []byte
+}
+
+// ParseVerifier decodes a sealed verifier, bare public keys sealed before
+// verifier versioning are decoded as Ed25519 keys with default key derivation
+// parameters. Verifiers without salt use the principal as salt.
+func ParseVerifier(value string) (*Verifier, error) {
+	// Legacy public key
+	if !strings.HasPrefix(value, "$") {
+		pub, err := decodePublicKey(suite.Ed25519, value)
+		if err != nil {
+			return nil, err
+		}
+		return &Verifier{
+			Suite:     suite.Ed25519,
+			KDF:       kdf.DefaultParams,
+			PublicKey: pub,
+		}, nil
+	}
+
+	parts := strings.Split(value, "$")
+	if len(parts) < 3 || parts[0] != "" || parts[1] != "anvil" {
+		return nil, fmt.Errorf("anvil: Invalid verifier encoding")
+	}
+
+	// Check version
+	if parts[2] != fmt.Sprintf("v=%d", verifierVersion) {
+		return nil, fmt.Errorf("anvil: Unsupported verifier version '%s'", parts[2])
+	}
+	if len(parts) != 8 {
+		return nil, fmt.Errorf("anvil: Invalid verifier encoding")
+	}
+	encodedSuite, encodedKDF, encodedSalt, encodedPublicKey := parts[3], parts[4]+"$"+parts[5], parts[6], parts[7]
+
+	// Decode signature suite
+	s, err := suite.Lookup(encodedSuite)
+	if err != nil {
+		return nil, fmt.Errorf("anvil: Invalid verifier signature suite, %v", err)
+	}
+
+	// Decode key derivation parameters
+	params, err := kdf.Parse(encodedKDF)
+	if err != nil {
+		return nil, fmt.Errorf("anvil: Invalid verifier key derivation parameters, %v", err)
+	}
+
+	// Decode salt
+	salt, err := fromOKP(encodedSalt)
+	if err != nil {
+		return nil, fmt.Errorf("anvil: Invalid verifier salt, %v", err)
+	}
+	if len(salt) == 0 {
+		salt = nil
+	}
+
+	// Decode public key
+	pub, err := decodePublicKey(s, encodedPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Verifier{
+		Suite:     s,
+		KDF:       params,
+		Salt:      salt,
+		PublicKey: pub,
+	}, nil
+}
+
+// String encodes the verifier
+func (v *Verifier) String() string {
+	s := v.Suite
+	if s == nil {
+		s = suite.Default
+	}
+	return fmt.Sprintf("$anvil$v=%d$%s$%s$%s$%s", verifierVersion, s.Name(), v.KDF.String(), toOKP(v.Salt), toOKP(v.PublicKey))
+}
+
+// CheckPolicy refuses verifiers sealed below the policy minimum cost, servers
+// should check verifiers before accepting them.
+func (v *Verifier) CheckPolicy(policy kdf.Policy) error {
+	if err := policy.Check(v.KDF); err != nil {
+		return fmt.Errorf("%w, %v", ErrWeakVerifier, err)
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+func decodePublicKey(s suite.Suite, value string) ([]byte, error) {
+	pub, err := fromOKP(value)
+	if err != nil {
+		return nil, fmt.Errorf("anvil: Invalid public key, %v", err)
+	}
+	if err := s.ValidatePublicKey(pub); err != nil {
+		return nil, fmt.Errorf("anvil: Invalid public key, %v", err)
+	}
+	return pub, nil
+}